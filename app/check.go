@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"api-go/helper"
+	"api-go/migrations"
+)
+
+// runCheck validates the config, connects to the database and reports the
+// migrations state. It exits with status 1 when something is wrong.
+func runCheck(args []string) {
+	flags, configPath := newFlagSet("check", "check [-config file] [-timeout 10s] [-migrations]")
+	timeout := flags.Duration("timeout", 0, "how long to wait for the database, overrides database.connect_timeout")
+	requireMigrations := flags.Bool("migrations", false, "fail when migrations are pending")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		usageError(flags, "unexpected arguments %v", flags.Args())
+	}
+
+	path, err := helper.ConfigPath(*configPath)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	config := loadConfig(*configPath)
+	fmt.Printf("config      ok (%s)\n", path)
+
+	if *timeout > 0 {
+		config.Database.ConnectTimeout = *timeout
+	}
+	start := time.Now()
+	db, err := helper.SetupDatabase(config)
+	if err != nil {
+		fmt.Printf("database    FAIL %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	var serverVersion string
+	if err := db.QueryRow("SHOW server_version").Scan(&serverVersion); err != nil {
+		fmt.Printf("database    FAIL %v\n", helper.Redact(err.Error()))
+		os.Exit(1)
+	}
+	fmt.Printf("database    ok (%s, PostgreSQL %s, %s)\n", config.Database.Address(), serverVersion, time.Since(start).Round(time.Millisecond))
+
+	migrationList, err := helper.LoadMigrations(migrations.FS)
+	if err != nil {
+		fmt.Printf("migrations  FAIL %v\n", err)
+		os.Exit(1)
+	}
+	pending, err := helper.PendingMigrations(db, migrationList)
+	if err != nil {
+		fmt.Printf("migrations  FAIL %v\n", err)
+		os.Exit(1)
+	}
+	if len(pending) > 0 {
+		fmt.Printf("migrations  %d pending\n", len(pending))
+		if *requireMigrations {
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Printf("migrations  ok (%d applied)\n", len(migrationList))
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"api-go/helper"
+)
+
+const configUsage = "config file, defaults to devops/$APP_ENV/config.yaml with APP_ENV=local"
+
+// newFlagSet returns the flags of a command, with the -config flag every
+// command shares
+func newFlagSet(name, usage string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s\n\nflags:\n", usage)
+		flags.PrintDefaults()
+	}
+	configPath := flags.String("config", "", configUsage)
+	return flags, configPath
+}
+
+// loadConfig loads the config or exits
+func loadConfig(configPath string) helper.Config {
+	config, err := helper.LoadConfig(configPath)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	return config
+}
+
+// openDatabase loads the config and connects to the database, or exits
+func openDatabase(configPath string) (helper.Config, *sql.DB) {
+	config := loadConfig(configPath)
+	db, err := helper.SetupDatabase(config)
+	if err != nil {
+		log.Fatalf("Error setting up database: %v", err)
+	}
+	return config, db
+}
+
+// usageError prints the usage of a command and exits
+func usageError(flags *flag.FlagSet, format string, args ...interface{}) {
+	fmt.Fprintf(flags.Output(), format+"\n\n", args...)
+	flags.Usage()
+	os.Exit(2)
+}
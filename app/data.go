@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"api-go/helper"
+)
+
+// runExport writes the rows of the data tables as JSON
+func runExport(args []string) {
+	flags, configPath := newFlagSet("export", "export [-config file] [-out file] [-tables post,tag]")
+	out := flags.String("out", "", "file to write, standard output by default")
+	tables := flags.String("tables", "", "comma separated tables to export, all of them by default")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		usageError(flags, "unexpected arguments %v", flags.Args())
+	}
+
+	_, db := openDatabase(*configPath)
+	defer db.Close()
+
+	var names []string
+	if *tables != "" {
+		names = strings.Split(*tables, ",")
+	}
+
+	dump, err := helper.ExportData(db, names...)
+	if err != nil {
+		log.Fatalf("Error exporting data: %v", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("Error creating %s: %v", *out, err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(dump); err != nil {
+		log.Fatalf("Error writing export: %v", err)
+	}
+	for _, table := range dump.Tables {
+		log.Printf("Exported %d row(s) of %s", len(table.Rows), table.Name)
+	}
+}
+
+// runImport loads a file written by export
+func runImport(args []string) {
+	flags, configPath := newFlagSet("import", "import [-config file] [-in file] [-truncate] [-skip-existing]")
+	in := flags.String("in", "", "file to read, standard input by default")
+	truncate := flags.Bool("truncate", false, "empty the imported tables first")
+	skipExisting := flags.Bool("skip-existing", false, "skip rows conflicting with existing ones instead of failing")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		usageError(flags, "unexpected arguments %v", flags.Args())
+	}
+
+	dump, err := readDump(*in)
+	if err != nil {
+		log.Fatalf("Error reading import: %v", err)
+	}
+
+	_, db := openDatabase(*configPath)
+	defer db.Close()
+
+	inserted, err := helper.ImportData(db, dump, helper.ImportOptions{Truncate: *truncate, SkipExisting: *skipExisting})
+	if err != nil {
+		log.Fatalf("Error importing data: %v", err)
+	}
+	for _, table := range dump.Tables {
+		log.Printf("Imported %d of %d row(s) into %s", inserted[table.Name], len(table.Rows), table.Name)
+	}
+}
+
+// readDump decodes an export from path, or from standard input
+func readDump(path string) (*helper.DataDump, error) {
+	var r io.Reader = os.Stdin
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	decoder.DisallowUnknownFields()
+
+	var dump helper.DataDump
+	if err := decoder.Decode(&dump); err != nil {
+		return nil, err
+	}
+	return &dump, nil
+}
@@ -1,116 +1,67 @@
 package main
 
 import (
+	"fmt"
 	"log"
-	"net/http"
-	"strconv"
+	"os"
 	"strings"
 
 	"api-go/helper"
 	"api-go/model"
-
-	"api-go/logic"
 )
 
-func main() {
-	config, err := helper.LoadConfig()
-	if err != nil {
-		log.Fatalf("Error loading config: %v", err)
-	}
-
-	db, err := helper.SetupDatabase(config)
-	if err != nil {
-		log.Fatalf("Error setting up database: %v", err)
-	}
-
-	modelsToCreate := []interface{}{
-		model.Post{},
-		model.Tag{},
-	}
-
-	for _, model := range modelsToCreate {
-		err := helper.CreateTableFromModel(db, model)
-		if err != nil {
-			log.Fatalf("Error setting up table for model %T: %v", model, err)
-		}
+// command is a subcommand of the binary, run with the arguments following
+// its name
+type command struct {
+	summary string
+	run     func(args []string)
+}
 
-		err = helper.UpdateTableFromModel(db, model)
-		if err != nil {
-			log.Fatalf("Error updating table for model %T: %v", model, err)
-		}
-	}
+var commands = map[string]command{
+	"serve":   {"start the API server (default)", runServe},
+	"migrate": {"apply, revert or list migrations", runMigrate},
+	"schema":  {"sync or plan the schema straight from the models", runSchema},
+	"seed":    {"load fixtures", runSeed},
+	"export":  {"write table data as JSON", runExport},
+	"import":  {"load table data written by export", runImport},
+	"check":   {"validate the config and database connectivity", runCheck},
+}
 
-	// Array of pairs for join tables
-	joinTablePairs := [][]string{
-		{"post", "tag"},
-	}
+// commandOrder lists the commands in the usage text
+var commandOrder = []string{"serve", "migrate", "schema", "seed", "export", "import", "check"}
 
-	err = helper.CreateJoinTables(db, joinTablePairs)
+func main() {
+	err := helper.RegisterModels(model.Post{}, model.Tag{})
 	if err != nil {
-		log.Fatalf("Error creating join tables: %v", err)
+		log.Fatalf("Error registering models: %v", err)
 	}
 
-	// Define API routes
-	http.HandleFunc("/api/posts", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost {
-			logic.CreatePost(db)(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	// without a command, or with flags only, the server starts
+	args := os.Args[1:]
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+			fmt.Fprint(os.Stderr, usage())
+			os.Exit(2)
 		}
-	})
-
-	http.HandleFunc("/api/posts/", func(w http.ResponseWriter, r *http.Request) {
-		postID, err := getIDFromURL(r)
-		if err != nil {
-			http.Error(w, "Invalid post ID", http.StatusBadRequest)
-			return
-		}
-		switch r.Method {
-		case http.MethodPut:
-			logic.UpdatePost(db, postID)(w, r)
-		case http.MethodDelete:
-			logic.DeletePost(db, postID)(w, r)
-		case http.MethodGet:
-			logic.GetPostByID(db, postID)(w, r)
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
-
-	http.HandleFunc("/api/tag", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost {
-			logic.CreatePost(db)(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
-
-	http.HandleFunc("/api/tag/", func(w http.ResponseWriter, r *http.Request) {
-		postID, err := getIDFromURL(r)
-		if err != nil {
-			http.Error(w, "Invalid tag ID", http.StatusBadRequest)
-			return
-		}
-		switch r.Method {
-		case http.MethodPut:
-			logic.UpdateTag(db, postID)(w, r)
-		case http.MethodDelete:
-			logic.DeleteTag(db, postID)(w, r)
-		case http.MethodGet:
-			logic.GetTagByID(db, postID)(w, r)
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
+		runServe(args)
+		return
+	}
 
-	log.Println("Starting server on :8081")
-	if err := http.ListenAndServe(":8081", nil); err != nil {
-		log.Fatalf("Error starting server: %v", err)
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage())
+		os.Exit(2)
 	}
+	cmd.run(args[1:])
 }
 
-func getIDFromURL(r *http.Request) (int, error) {
-	urlParts := strings.Split(r.URL.Path, "/")
-	idStr := urlParts[len(urlParts)-1]
-	return strconv.Atoi(idStr)
+// usage lists the commands
+func usage() string {
+	var b strings.Builder
+	b.WriteString("usage: api-go <command> [flags]\n\ncommands:\n")
+	for _, name := range commandOrder {
+		fmt.Fprintf(&b, "  %-8s %s\n", name, commands[name].summary)
+	}
+	b.WriteString("\nrun api-go <command> -h for the flags of a command\n")
+	return b.String()
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+
+	"api-go/helper"
+	"api-go/migrations"
+)
+
+// runMigrate handles the migrate up, down and status commands
+func runMigrate(args []string) {
+	flags, configPath := newFlagSet("migrate", "migrate [-config file] up | down [N] | status")
+	flags.Parse(args)
+	args = flags.Args()
+
+	if len(args) == 0 {
+		usageError(flags, "missing subcommand")
+	}
+	switch args[0] {
+	case "up", "down", "status":
+	default:
+		usageError(flags, "unknown subcommand %q", args[0])
+	}
+
+	_, db := openDatabase(*configPath)
+	defer db.Close()
+
+	migrationList, err := helper.LoadMigrations(migrations.FS)
+	if err != nil {
+		log.Fatalf("Error loading migrations: %v", err)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := helper.MigrateUp(db, migrationList)
+		if err != nil {
+			log.Fatalf("Error applying migrations (%d applied): %v", applied, err)
+		}
+		log.Printf("Applied %d migration(s)", applied)
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			n, err = strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				log.Fatalf("Invalid number of migrations %q", args[1])
+			}
+		}
+		reverted, err := helper.MigrateDown(db, migrationList, n)
+		if err != nil {
+			log.Fatalf("Error reverting migrations (%d reverted): %v", reverted, err)
+		}
+		log.Printf("Reverted %d migration(s)", reverted)
+	case "status":
+		statuses, err := helper.GetMigrationStatus(db, migrationList)
+		if err != nil {
+			log.Fatalf("Error reading migration status: %v", err)
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d %-30s %s\n", status.Version, status.Name, state)
+		}
+	}
+}
+
+// checkMigrations refuses to serve with pending migrations unless autoMigrate is set
+func checkMigrations(db *sql.DB, migrationList []helper.Migration, autoMigrate bool) error {
+	pending, err := helper.PendingMigrations(db, migrationList)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if !autoMigrate {
+		return fmt.Errorf("%d pending migration(s), run `migrate up` or start with -auto-migrate", len(pending))
+	}
+
+	applied, err := helper.MigrateUp(db, migrationList)
+	if err != nil {
+		return err
+	}
+	log.Printf("Applied %d migration(s)", applied)
+	return nil
+}
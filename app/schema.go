@@ -0,0 +1,87 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"api-go/helper"
+)
+
+// runSchema handles the schema commands. sync creates and extends tables
+// straight from the models, plan prints the SQL sync would run so it can be
+// reviewed or turned into a migration. Deployments use migrations instead.
+func runSchema(args []string) {
+	flags, configPath := newFlagSet("schema", "schema [-config file] sync | plan")
+	flags.Parse(args)
+	args = flags.Args()
+
+	if len(args) == 0 {
+		usageError(flags, "missing subcommand")
+	}
+	switch args[0] {
+	case "sync", "plan":
+	default:
+		usageError(flags, "unknown subcommand %q", args[0])
+	}
+
+	_, db := openDatabase(*configPath)
+	defer db.Close()
+
+	var models []interface{}
+	for _, meta := range helper.RegisteredModels() {
+		models = append(models, meta.Type)
+	}
+
+	switch args[0] {
+	case "sync":
+		syncSchema(db, models)
+	case "plan":
+		changes, err := helper.PlanSchema(db, models...)
+		if err != nil {
+			log.Fatalf("Error planning schema changes: %v", err)
+		}
+
+		relations, err := helper.DiscoverRelations(models...)
+		if err != nil {
+			log.Fatalf("Error reading model relations: %v", err)
+		}
+		relationChanges, err := helper.PlanRelations(db, relations)
+		if err != nil {
+			log.Fatalf("Error planning relation changes: %v", err)
+		}
+
+		fmt.Print(helper.FormatSchemaPlan(append(changes, relationChanges...)))
+	}
+}
+
+// syncSchema applies the model changes, then creates the join tables and
+// foreign keys of the relations declared on the models
+func syncSchema(db *sql.DB, models []interface{}) {
+	for _, model := range models {
+		err := helper.CreateTableFromModel(db, model)
+		if err != nil {
+			log.Fatalf("Error setting up table for model %v: %v", model, err)
+		}
+
+		err = helper.UpdateTableFromModel(db, model)
+		if err != nil {
+			log.Fatalf("Error updating table for model %v: %v", model, err)
+		}
+	}
+
+	relations, err := helper.DiscoverRelations(models...)
+	if err != nil {
+		log.Fatalf("Error reading model relations: %v", err)
+	}
+
+	err = helper.CreateJoinTables(db, relations)
+	if err != nil {
+		log.Fatalf("Error creating join tables: %v", err)
+	}
+
+	err = helper.CreateForeignKeys(db, relations)
+	if err != nil {
+		log.Fatalf("Error creating foreign keys: %v", err)
+	}
+}
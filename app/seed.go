@@ -0,0 +1,36 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"api-go/logic"
+)
+
+// runSeed upserts the tags and posts of fixture sets, directories of YAML
+// or JSON files. Seeding twice changes nothing.
+func runSeed(args []string) {
+	flags, configPath := newFlagSet("seed", "seed [-config file] [-dir fixtures] [-set demo,e2e]")
+	dir := flags.String("dir", "fixtures", "directory holding one directory per fixture set")
+	sets := flags.String("set", "demo", "comma separated fixture sets to load")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		usageError(flags, "unexpected arguments %v", flags.Args())
+	}
+
+	fixtures, err := logic.LoadFixtures(os.DirFS(*dir), strings.Split(*sets, ",")...)
+	if err != nil {
+		log.Fatalf("Error loading fixtures: %v", err)
+	}
+
+	_, db := openDatabase(*configPath)
+	defer db.Close()
+
+	result, err := logic.SeedFixtures(db, fixtures)
+	if err != nil {
+		log.Fatalf("Error seeding fixtures: %v", err)
+	}
+	log.Printf("Seeded %s: %d tag(s), %d post(s) created, %d post(s) updated",
+		*sets, result.Tags, result.PostsCreated, result.PostsUpdated)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"api-go/helper"
+	"api-go/logic"
+	"api-go/migrations"
+)
+
+// runServe starts the API server
+func runServe(args []string) {
+	flags, configPath := newFlagSet("serve", "serve [-config file] [-auto-migrate] [-addr host:port]")
+	autoMigrate := flags.Bool("auto-migrate", false, "apply pending migrations before starting the server")
+	addr := flags.String("addr", "", "listen address, overrides server.addr")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		usageError(flags, "unexpected arguments %v", flags.Args())
+	}
+
+	config := loadConfig(*configPath)
+	if *addr != "" {
+		config.Server.Addr = *addr
+		if err := config.Validate(); err != nil {
+			usageError(flags, "invalid -addr: %v", err)
+		}
+	}
+	db, err := helper.SetupDatabase(config)
+	if err != nil {
+		log.Fatalf("Error setting up database: %v", err)
+	}
+
+	migrationList, err := helper.LoadMigrations(migrations.FS)
+	if err != nil {
+		log.Fatalf("Error loading migrations: %v", err)
+	}
+
+	err = checkMigrations(db, migrationList, *autoMigrate)
+	if err != nil {
+		log.Fatalf("Error checking migrations: %v", err)
+	}
+
+	health := logic.NewHealth(db, migrationList, buildVersion())
+
+	server := helper.NewServer(config.Server, routes(db, health))
+	log.Printf("Starting server on %s (TLS %t)", server.Addr, config.Server.TLSEnabled())
+	if err := serveUntilSignal(server, config.Server, health, db); err != nil {
+		log.Fatalf("Error starting server: %v", err)
+	}
+}
+
+// routes defines the API routes
+func routes(db *sql.DB, health *logic.Health) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", health.Healthz())
+	mux.HandleFunc("/readyz", health.Readyz())
+	mux.HandleFunc("/api/_status", health.Status())
+
+	mux.HandleFunc("/api/posts", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			logic.CreatePost(db)(w, r)
+		case http.MethodGet:
+			logic.GetAllPosts(db)(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/posts/search", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			logic.SearchPosts(db)(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/posts/", func(w http.ResponseWriter, r *http.Request) {
+		postID, sub, err := parseResourcePath(r, "/api/posts/")
+		if err != nil {
+			http.Error(w, "Invalid post ID", http.StatusBadRequest)
+			return
+		}
+		switch sub {
+		case "":
+		case "transitions":
+			if r.Method == http.MethodPost {
+				logic.TransitionPost(db, postID)(w, r)
+			} else {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			logic.UpdatePost(db, postID)(w, r)
+		case http.MethodPatch:
+			logic.PatchPost(db, postID)(w, r)
+		case http.MethodDelete:
+			logic.DeletePost(db, postID)(w, r)
+		case http.MethodGet:
+			logic.GetPostByID(db, postID)(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/tag", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			logic.CreateTag(db)(w, r)
+		case http.MethodGet:
+			logic.GetAllTags(db)(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/tag/", func(w http.ResponseWriter, r *http.Request) {
+		tagID, sub, err := parseResourcePath(r, "/api/tag/")
+		if err != nil {
+			http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+			return
+		}
+		switch sub {
+		case "":
+		case "posts":
+			if r.Method == http.MethodGet {
+				logic.GetTagPosts(db, tagID)(w, r)
+			} else {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			logic.UpdateTag(db, tagID)(w, r)
+		case http.MethodDelete:
+			logic.DeleteTag(db, tagID)(w, r)
+		case http.MethodGet:
+			logic.GetTagByID(db, tagID)(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	return mux
+}
+
+// parseResourcePath splits the path of a request below prefix into the
+// resource id and the rest of the path, e.g. 5 and "posts" for /api/tag/5/posts
+func parseResourcePath(r *http.Request, prefix string) (int, string, error) {
+	idStr, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	id, err := strconv.Atoi(idStr)
+	return id, sub, err
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"api-go/helper"
+	"api-go/logic"
+)
+
+// serveUntilSignal runs the server until SIGINT or SIGTERM. It then fails
+// the readiness probe, keeps serving for the shutdown delay so load balancers
+// notice, stops accepting connections, lets in-flight requests finish within
+// the shutdown grace period and closes the database.
+func serveUntilSignal(server *http.Server, config helper.ServerConfig, health *logic.Health, db *sql.DB) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- helper.Serve(server, config)
+	}()
+
+	select {
+	case err := <-serveErr:
+		// the server could not start or stopped on its own
+		db.Close()
+		return err
+	case <-ctx.Done():
+	}
+	// a second signal kills the process right away
+	stop()
+
+	health.SetShuttingDown()
+	if config.ShutdownDelay > 0 {
+		log.Printf("Shutting down, readiness failing, serving for %s more", config.ShutdownDelay)
+		time.Sleep(config.ShutdownDelay)
+	}
+
+	log.Printf("Shutting down, draining requests for up to %s", config.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+
+	err := server.Shutdown(shutdownCtx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Printf("Grace period over, closing remaining connections")
+		err = server.Close()
+	}
+	if err != nil {
+		log.Printf("Error shutting down server: %v", err)
+	}
+
+	if err := db.Close(); err != nil {
+		log.Printf("Error closing database: %v", err)
+	}
+
+	log.Println("Server stopped")
+	return nil
+}
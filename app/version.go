@@ -0,0 +1,27 @@
+package main
+
+import "runtime/debug"
+
+// version is set at build time:
+//
+//	go build -ldflags "-X main.version=1.2.0" ./app
+var version = ""
+
+// buildVersion returns the version set at build time, or the VCS revision
+// recorded by the go tool
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "dev"
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" && len(setting.Value) >= 12 {
+			return setting.Value[:12]
+		}
+	}
+	return "dev"
+}
@@ -0,0 +1,378 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// envPrefix starts the environment variables overriding config values, the
+// yaml keys follow in upper case: APP_DATABASE_HOST, APP_DATABASE_MAX_OPEN_CONNS
+const envPrefix = "APP"
+
+// defaultEnv is the environment loaded when neither -config nor APP_ENV is set
+const defaultEnv = "local"
+
+type Config struct {
+	Database DatabaseConfig `yaml:"database"`
+	Server   ServerConfig   `yaml:"server"`
+}
+
+// DatabaseConfig holds the PostgreSQL connection settings
+type DatabaseConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password Secret `yaml:"password"`
+	DBName   string `yaml:"dbname"`
+
+	// the password can instead be read from a file, such as a container
+	// secret, or from another environment variable. Without any of them it
+	// is looked up in a pgpass file: passfile, $PGPASSFILE or ~/.pgpass.
+	PasswordFile string `yaml:"password_file"`
+	PasswordEnv  string `yaml:"password_env"`
+	PassFile     string `yaml:"passfile"`
+
+	// sslmode is one of disable, allow, prefer, require, verify-ca and
+	// verify-full, sslrootcert the CA file used by the verify modes
+	SSLMode     string `yaml:"sslmode"`
+	SSLRootCert string `yaml:"sslrootcert"`
+
+	// DSN is a complete connection string, URL or key=value, replacing the
+	// connection fields above
+	DSN Secret `yaml:"dsn"`
+
+	// connection pool, the defaults below apply when left out
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+
+	// startup waits for the server, retrying with exponential backoff
+	// from RetryInterval up to RetryMaxInterval until ConnectTimeout
+	ConnectTimeout   time.Duration `yaml:"connect_timeout"`
+	RetryInterval    time.Duration `yaml:"retry_interval"`
+	RetryMaxInterval time.Duration `yaml:"retry_max_interval"`
+}
+
+// ServerConfig holds the HTTP server settings
+type ServerConfig struct {
+	Addr string `yaml:"addr"`
+
+	// ReadHeaderTimeout bounds reading the request headers, ReadTimeout the
+	// whole request, WriteTimeout writing the response and IdleTimeout how
+	// long a keep-alive connection waits for its next request
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes"`
+
+	// ShutdownDelay keeps serving with a failing readiness probe once the
+	// server is asked to stop, ShutdownTimeout is then the grace period
+	// in-flight requests get to finish
+	ShutdownDelay   time.Duration `yaml:"shutdown_delay"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	// TLS is served when both the certificate and key files are set, with
+	// HTTP/2 unless it is disabled
+	TLSCert      string `yaml:"tls_cert"`
+	TLSKey       string `yaml:"tls_key"`
+	DisableHTTP2 bool   `yaml:"disable_http2"`
+}
+
+// connection defaults used when the config leaves them out
+const (
+	defaultSSLMode          = "disable"
+	defaultMaxOpenConns     = 20
+	defaultMaxIdleConns     = 10
+	defaultConnMaxLifetime  = 30 * time.Minute
+	defaultConnMaxIdleTime  = 5 * time.Minute
+	defaultConnectTimeout   = 30 * time.Second
+	defaultRetryInterval    = 500 * time.Millisecond
+	defaultRetryMaxInterval = 5 * time.Second
+)
+
+// server defaults used when the config leaves them out
+const (
+	defaultServerAddr        = ":8081"
+	defaultReadTimeout       = 15 * time.Second
+	defaultReadHeaderTimeout = 5 * time.Second
+	defaultWriteTimeout      = 15 * time.Second
+	defaultIdleTimeout       = 60 * time.Second
+	defaultMaxHeaderBytes    = 1 << 20
+	defaultShutdownTimeout   = 30 * time.Second
+)
+
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// ConfigPath returns the config file to load: path when given, otherwise
+// devops/<APP_ENV>/config.yaml, devops/local/config.yaml without APP_ENV
+func ConfigPath(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+
+	env := os.Getenv(envPrefix + "_ENV")
+	if env == "" {
+		env = defaultEnv
+	}
+	if env != filepath.Base(env) || env == "." || env == ".." {
+		return "", fmt.Errorf("invalid %s_ENV %q", envPrefix, env)
+	}
+	return filepath.Join("devops", env, "config.yaml"), nil
+}
+
+// LoadConfig reads the config file selected by ConfigPath, applies the
+// environment overrides and defaults, resolves the password and validates
+// the result. Secrets are redacted from the returned errors.
+func LoadConfig(path string) (Config, error) {
+	config, err := loadConfig(path)
+	return config, redactError(err)
+}
+
+func loadConfig(path string) (Config, error) {
+	var config Config
+	path, err := ConfigPath(path)
+	if err != nil {
+		return config, err
+	}
+
+	configPath, err := filepath.Abs(path)
+	if err != nil {
+		return config, errors.New("error getting absolute path for config file: " + err.Error())
+	}
+
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		return config, errors.New("error reading config file: " + err.Error())
+	}
+
+	err = yaml.UnmarshalStrict(configFile, &config)
+	if err != nil {
+		return config, fmt.Errorf("error unmarshalling config file %s: %v", configPath, err)
+	}
+
+	err = applyEnvOverrides(reflect.ValueOf(&config).Elem(), envPrefix)
+	if err != nil {
+		return config, err
+	}
+	err = config.Database.resolvePassword()
+	if err != nil {
+		return config, err
+	}
+	config.setDefaults()
+
+	err = config.Validate()
+	if err != nil {
+		return config, fmt.Errorf("invalid config %s: %v", configPath, err)
+	}
+	return config, nil
+}
+
+// applyEnvOverrides sets the fields of a config struct from the environment
+// variables named after their yaml keys
+func applyEnvOverrides(v reflect.Value, prefix string) error {
+	for i := 0; i < v.NumField(); i++ {
+		key := strings.Split(v.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(key)
+		field := v.Field(i)
+
+		if field.Kind() == reflect.Struct {
+			if err := applyEnvOverrides(field, name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setFromString(field, value); err != nil {
+			return fmt.Errorf("invalid %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// setFromString parses an environment value into a config field
+func setFromString(field reflect.Value, value string) error {
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+// setDefaults fills the settings left out of the config
+func (config *Config) setDefaults() {
+	database := &config.Database
+	if database.SSLMode == "" {
+		database.SSLMode = defaultSSLMode
+	}
+	if database.MaxOpenConns == 0 {
+		database.MaxOpenConns = defaultMaxOpenConns
+	}
+	if database.MaxIdleConns == 0 {
+		// a smaller pool keeps all of its connections idle
+		database.MaxIdleConns = defaultMaxIdleConns
+		if database.MaxOpenConns > 0 && database.MaxOpenConns < defaultMaxIdleConns {
+			database.MaxIdleConns = database.MaxOpenConns
+		}
+	}
+	if database.ConnMaxLifetime == 0 {
+		database.ConnMaxLifetime = defaultConnMaxLifetime
+	}
+	if database.ConnMaxIdleTime == 0 {
+		database.ConnMaxIdleTime = defaultConnMaxIdleTime
+	}
+	if database.ConnectTimeout == 0 {
+		database.ConnectTimeout = defaultConnectTimeout
+	}
+	if database.RetryInterval == 0 {
+		database.RetryInterval = defaultRetryInterval
+	}
+	if database.RetryMaxInterval == 0 {
+		database.RetryMaxInterval = defaultRetryMaxInterval
+	}
+
+	server := &config.Server
+	if server.Addr == "" {
+		server.Addr = defaultServerAddr
+	}
+	if server.ReadTimeout == 0 {
+		server.ReadTimeout = defaultReadTimeout
+	}
+	if server.ReadHeaderTimeout == 0 {
+		server.ReadHeaderTimeout = defaultReadHeaderTimeout
+	}
+	if server.WriteTimeout == 0 {
+		server.WriteTimeout = defaultWriteTimeout
+	}
+	if server.IdleTimeout == 0 {
+		server.IdleTimeout = defaultIdleTimeout
+	}
+	if server.MaxHeaderBytes == 0 {
+		server.MaxHeaderBytes = defaultMaxHeaderBytes
+	}
+	if server.ShutdownTimeout == 0 {
+		server.ShutdownTimeout = defaultShutdownTimeout
+	}
+}
+
+// Validate reports every missing or invalid setting at once
+func (config Config) Validate() error {
+	var problems []string
+	database := config.Database
+
+	if database.DSN == "" {
+		if database.Host == "" {
+			problems = append(problems, "database.host is required")
+		}
+		if database.Port < 1 || database.Port > 65535 {
+			problems = append(problems, fmt.Sprintf("database.port %d is not a valid port", database.Port))
+		}
+		if database.User == "" {
+			problems = append(problems, "database.user is required")
+		}
+		if database.DBName == "" {
+			problems = append(problems, "database.dbname is required")
+		}
+
+		validMode := false
+		for _, mode := range sslModes {
+			validMode = validMode || database.SSLMode == mode
+		}
+		if !validMode {
+			problems = append(problems, fmt.Sprintf("database.sslmode %q must be one of %s", database.SSLMode, strings.Join(sslModes, ", ")))
+		}
+		if database.SSLRootCert != "" {
+			if _, err := os.Stat(database.SSLRootCert); err != nil {
+				problems = append(problems, "database.sslrootcert: "+err.Error())
+			}
+		}
+	}
+
+	if database.MaxOpenConns < 0 || database.MaxIdleConns < 0 {
+		problems = append(problems, "database.max_open_conns and database.max_idle_conns cannot be negative")
+	} else if database.MaxIdleConns > database.MaxOpenConns {
+		problems = append(problems, fmt.Sprintf("database.max_idle_conns %d is above database.max_open_conns %d", database.MaxIdleConns, database.MaxOpenConns))
+	}
+	if database.ConnMaxLifetime < 0 || database.ConnMaxIdleTime < 0 {
+		problems = append(problems, "database.conn_max_lifetime and database.conn_max_idle_time cannot be negative")
+	}
+	if database.ConnectTimeout < 0 || database.RetryInterval < 0 || database.RetryMaxInterval < 0 {
+		problems = append(problems, "database.connect_timeout, database.retry_interval and database.retry_max_interval cannot be negative")
+	} else if database.RetryInterval > database.RetryMaxInterval {
+		problems = append(problems, "database.retry_interval is above database.retry_max_interval")
+	}
+
+	server := config.Server
+	if _, _, err := net.SplitHostPort(server.Addr); err != nil {
+		problems = append(problems, fmt.Sprintf("server.addr %q is not a host:port address", server.Addr))
+	}
+	if server.ReadTimeout < 0 || server.ReadHeaderTimeout < 0 || server.WriteTimeout < 0 || server.IdleTimeout < 0 || server.ShutdownDelay < 0 || server.ShutdownTimeout < 0 {
+		problems = append(problems, "server timeouts cannot be negative")
+	}
+	if server.MaxHeaderBytes < 0 {
+		problems = append(problems, "server.max_header_bytes cannot be negative")
+	}
+	if (server.TLSCert == "") != (server.TLSKey == "") {
+		problems = append(problems, "server.tls_cert and server.tls_key must be set together")
+	}
+	for _, path := range []string{server.TLSCert, server.TLSKey} {
+		if path != "" {
+			if _, err := os.Stat(path); err != nil {
+				problems = append(problems, "server TLS file: "+err.Error())
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Address describes the server connected to, for logs
+func (database DatabaseConfig) Address() string {
+	if database.DSN != "" {
+		return "the dsn server"
+	}
+	return fmt.Sprintf("%s:%d", database.Host, database.Port)
+}
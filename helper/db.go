@@ -1,66 +1,57 @@
 package helper
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"log"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
-	"gopkg.in/yaml.v2"
-)
+	"api-go/sqlb"
 
-type Config struct {
-	Database struct {
-		Host     string `yaml:"host"`
-		Port     int    `yaml:"port"`
-		User     string `yaml:"user"`
-		Password string `yaml:"password"`
-		DBName   string `yaml:"dbname"`
-	} `yaml:"database"`
-}
+	"github.com/lib/pq"
+)
 
-func LoadConfig() (Config, error) {
-	var config Config
-	configPath, err := filepath.Abs("devops/local/config.yaml")
-	if err != nil {
-		return config, errors.New("error getting absolute path for config file: " + err.Error())
+// ConnectToPostgres opens a pool on the configured server. Without withDB
+// it connects to the default database of the user, to create the configured
+// one. A dsn in the config is used as is.
+func ConnectToPostgres(config Config, withDB bool) (*sql.DB, error) {
+	if config.Database.DSN != "" {
+		db, err := sql.Open("postgres", string(config.Database.DSN))
+		return db, redactError(err)
 	}
 
-	configFile, err := os.ReadFile(configPath)
-	if err != nil {
-		return config, errors.New("error reading config file: " + err.Error())
+	params := []string{
+		connParam("host", config.Database.Host),
+		connParam("port", strconv.Itoa(config.Database.Port)),
+		connParam("user", config.Database.User),
+		connParam("password", string(config.Database.Password)),
+		connParam("sslmode", config.Database.SSLMode),
 	}
-
-	err = yaml.Unmarshal(configFile, &config)
-	if err != nil {
-		return config, errors.New("error unmarshalling config file: " + err.Error())
+	if config.Database.SSLRootCert != "" {
+		params = append(params, connParam("sslrootcert", config.Database.SSLRootCert))
 	}
-
-	return config, nil
-}
-
-func ConnectToPostgres(config Config, withDB bool) (*sql.DB, error) {
-	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s sslmode=disable",
-		config.Database.Host,
-		config.Database.Port,
-		config.Database.User,
-		config.Database.Password,
-	)
 	if withDB {
-		connStr += fmt.Sprintf(" dbname=%s", config.Database.DBName)
+		params = append(params, connParam("dbname", config.Database.DBName))
 	}
-	return sql.Open("postgres", connStr)
+	return sql.Open("postgres", strings.Join(params, " "))
+}
+
+// connParam renders a key=value connection parameter, quoting the value so
+// spaces and quotes in passwords survive
+func connParam(key, value string) string {
+	return key + "='" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
 }
 
 func DatabaseExists(db *sql.DB, dbName string) (bool, error) {
 	var exists bool
-	query := fmt.Sprintf("SELECT 1 FROM pg_database WHERE datname = '%s'", dbName)
-	err := db.QueryRow(query).Scan(&exists)
+	query, args := sqlb.Select().ColumnExpr("EXISTS (SELECT 1 FROM pg_database WHERE datname = ?)", dbName).Build()
+	err := db.QueryRow(query, args...).Scan(&exists)
 	if err != nil {
 		return false, errors.New("error checking if database exists: " + err.Error())
 	}
@@ -68,29 +59,30 @@ func DatabaseExists(db *sql.DB, dbName string) (bool, error) {
 }
 
 func CreateDatabase(db *sql.DB, dbName string) error {
-	_, err := db.Exec(fmt.Sprintf("CREATE DATABASE %s", dbName))
+	_, err := db.Exec(sqlb.CreateDatabase(dbName))
 	if err != nil {
-		return errors.New("error creating database: " + err.Error())
+		return fmt.Errorf("error creating database: %w", err)
 	}
 	return nil
 }
 
+// SetupDatabase waits for PostgreSQL, creates the configured database if it
+// does not exist yet and returns a pool connected to it. With a dsn the
+// database has to exist already. Secrets are redacted from the returned
+// errors.
 func SetupDatabase(config Config) (*sql.DB, error) {
-	db, err := ConnectToPostgres(config, false)
-	if err != nil {
-		return nil, errors.New("error connecting to PostgreSQL: " + err.Error())
-	}
-	defer db.Close()
+	db, err := setupDatabase(config)
+	return db, redactError(err)
+}
 
-	dbExists, _ := DatabaseExists(db, config.Database.DBName)
-	// if err != nil {
-	// 	return nil, errors.New("error checking if database exists: " + err.Error())
-	// }
+func setupDatabase(config Config) (*sql.DB, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.Database.ConnectTimeout)
+	defer cancel()
 
-	if !dbExists {
-		err = CreateDatabase(db, config.Database.DBName)
+	if config.Database.DSN == "" {
+		err := ensureDatabase(ctx, config)
 		if err != nil {
-			return nil, errors.New("error creating database: " + err.Error())
+			return nil, err
 		}
 	}
 
@@ -99,174 +91,260 @@ func SetupDatabase(config Config) (*sql.DB, error) {
 		return nil, errors.New("error connecting to PostgreSQL with database: " + err.Error())
 	}
 
+	err = waitForPostgres(ctx, dbWithDB, config)
+	if err != nil {
+		dbWithDB.Close()
+		return nil, err
+	}
+	configurePool(dbWithDB, config)
+
 	return dbWithDB, nil
 }
 
-// CreateTableFromModel creates a table in the database based on a model
-func CreateTableFromModel(db *sql.DB, model interface{}) error {
-	modelType := reflect.TypeOf(model)
-	if modelType.Kind() != reflect.Struct {
-		return errors.New("model is not a struct")
+// ensureDatabase creates the configured database if it does not exist
+func ensureDatabase(ctx context.Context, config Config) error {
+	db, err := ConnectToPostgres(config, false)
+	if err != nil {
+		return errors.New("error connecting to PostgreSQL: " + err.Error())
 	}
+	defer db.Close()
 
-	tableName := strings.ToLower(modelType.Name())
+	err = waitForPostgres(ctx, db, config)
+	if err != nil {
+		return err
+	}
 
-	var columns []string
-	var primaryKey string
-	for i := 0; i < modelType.NumField(); i++ {
-		field := modelType.Field(i)
-		columnName := strings.ToLower(field.Name)
-		columnType := getColumnType(field.Type)
-
-		if columnType == "" {
-			continue
+	dbExists, err := DatabaseExists(db, config.Database.DBName)
+	if err != nil {
+		return err
+	}
+
+	if !dbExists {
+		err = CreateDatabase(db, config.Database.DBName)
+		// another instance starting at the same time may have created it
+		if err != nil && !isPostgresError(err, "42P04") {
+			return err
 		}
+	}
+	return nil
+}
 
-		if columnName == "id" {
-			primaryKey = columnName
-			columnType += " PRIMARY KEY"
+// waitForPostgres pings db until it answers, backing off exponentially
+// between attempts. Errors reported by the server, such as a wrong password,
+// are returned at once, only the server being unreachable or still starting
+// up is retried until ctx is done.
+func waitForPostgres(ctx context.Context, db *sql.DB, config Config) error {
+	interval := config.Database.RetryInterval
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() == nil && !isRetryableConnError(err) {
+			return errors.New("error connecting to PostgreSQL: " + err.Error())
 		}
 
-		// Check for unique constraint
-		if strings.Contains(field.Tag.Get("key"), "uniq") {
-			columnType += " UNIQUE"
+		log.Printf("PostgreSQL at %s not ready (attempt %d), retrying in %s: %v",
+			config.Database.Address(), attempt, interval, redactError(err))
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("error connecting to PostgreSQL: gave up after %d attempts in %s: %v",
+				attempt, config.Database.ConnectTimeout, err)
+		case <-time.After(interval):
 		}
 
-		columns = append(columns, fmt.Sprintf("%s %s", columnName, columnType))
+		interval *= 2
+		if interval > config.Database.RetryMaxInterval {
+			interval = config.Database.RetryMaxInterval
+		}
 	}
+}
 
-	if primaryKey == "" {
-		return errors.New("primary key not defined in model")
+// isRetryableConnError tells whether a failed ping may succeed later: the
+// server is unreachable, or answers that it is starting up (57P03)
+func isRetryableConnError(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "57P03"
 	}
+	return true
+}
 
-	createTableQuery := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s);", tableName, strings.Join(columns, ", "))
-
-	_, err := db.Exec(createTableQuery)
-	if err != nil {
-		return fmt.Errorf("error creating table %s: %v", tableName, err)
-	}
-	return nil
+// isPostgresError tells whether err is a server error with the given code
+func isPostgresError(err error, code pq.ErrorCode) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == code
 }
 
-// UpdateTableFromModel updates a table in the database based on a model
-func UpdateTableFromModel(db *sql.DB, model interface{}) error {
-	modelType := reflect.TypeOf(model)
-	if modelType.Kind() != reflect.Struct {
-		return errors.New("model is not a struct")
-	}
+// IsInvalidValueError tells whether err is PostgreSQL refusing a value, such
+// as text that is not a number or a timestamp
+func IsInvalidValueError(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code.Class() == "22"
+}
 
-	tableName := strings.ToLower(modelType.Name())
+// configurePool applies the connection pool settings of the config
+func configurePool(db *sql.DB, config Config) {
+	db.SetMaxOpenConns(config.Database.MaxOpenConns)
+	db.SetMaxIdleConns(config.Database.MaxIdleConns)
+	db.SetConnMaxLifetime(config.Database.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(config.Database.ConnMaxIdleTime)
+}
 
-	existingColumns, err := getExistingColumns(db, tableName)
+// CreateTableFromModel creates a table in the database based on a model
+func CreateTableFromModel(db *sql.DB, model interface{}) error {
+	meta, err := GetModelMeta(model)
 	if err != nil {
 		return err
 	}
 
-	var alterQueries []string
-	for i := 0; i < modelType.NumField(); i++ {
-		field := modelType.Field(i)
-		columnName := strings.ToLower(field.Name)
-		columnType := getColumnType(field.Type)
-
-		if columnType == "" {
-			continue
-		}
-
-		if _, exists := existingColumns[columnName]; !exists {
-			alterQuery := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", tableName, columnName, columnType)
-			alterQueries = append(alterQueries, alterQuery)
-
-			// Check for unique constraint
-			if strings.Contains(field.Tag.Get("key"), "uniq") {
-				alterUniqueQuery := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s_unique UNIQUE (%s);", tableName, columnName, columnName)
-				alterQueries = append(alterQueries, alterUniqueQuery)
-			}
-		}
-	}
-
-	for _, query := range alterQueries {
+	for _, query := range createTableQueries(meta.Table, meta.SchemaColumns()) {
 		_, err := db.Exec(query)
 		if err != nil {
-			return fmt.Errorf("error executing query %s: %v", query, err)
+			return fmt.Errorf("error creating table %s: %v", meta.Table, err)
 		}
 	}
 	return nil
 }
 
-// getColumnType returns the PostgreSQL column type for a given Go type
-func getColumnType(t reflect.Type) string {
-	switch t.Kind() {
-	case reflect.Int, reflect.Int64:
-		return "SERIAL"
-	case reflect.String:
-		return "TEXT"
-	case reflect.Struct:
-		if t == reflect.TypeOf(time.Time{}) {
-			return "TIMESTAMP"
-		}
-	case reflect.Slice:
-		// Handle many-to-many relationship by skipping
-		return ""
-	default:
-		return ""
+// UpdateTableFromModel updates a table in the database based on a model.
+// It applies the non destructive changes of PlanTableFromModel.
+func UpdateTableFromModel(db *sql.DB, model interface{}) error {
+	changes, err := PlanTableFromModel(db, model)
+	if err != nil {
+		return err
 	}
-	return ""
+	return ApplySchemaChanges(db, changes)
 }
 
-// getExistingColumns retrieves the existing columns of a table from the database
-func getExistingColumns(db *sql.DB, tableName string) (map[string]string, error) {
-	query := fmt.Sprintf("SELECT column_name, data_type FROM information_schema.columns WHERE table_name = '%s';", tableName)
-	rows, err := db.Query(query)
-	if err != nil {
-		return nil, fmt.Errorf("error querying existing columns: %v", err)
+// columnDefinition renders a column with its constraints for CREATE and ALTER
+func columnDefinition(column Column) string {
+	var constraints []string
+	if column.PrimaryKey {
+		constraints = append(constraints, "PRIMARY KEY")
+	} else if column.NotNull {
+		constraints = append(constraints, "NOT NULL")
+	}
+	if column.Default != "" {
+		constraints = append(constraints, "DEFAULT "+column.Default)
+	}
+	if column.Unique {
+		constraints = append(constraints, "UNIQUE")
 	}
-	defer rows.Close()
+	if column.Check != "" {
+		constraints = append(constraints, "CHECK ("+column.Check+")")
+	}
+	if column.Generated != "" {
+		constraints = append(constraints, "GENERATED ALWAYS AS ("+column.Generated+") STORED")
+	}
+	return sqlb.ColumnDef(column.Name, column.Type, constraints...)
+}
 
-	columns := make(map[string]string)
-	for rows.Next() {
-		var columnName, dataType string
-		if err := rows.Scan(&columnName, &dataType); err != nil {
-			return nil, fmt.Errorf("error scanning row: %v", err)
+// indexQuery returns the statement creating a secondary index on a column
+func indexQuery(tableName, columnName string) string {
+	return sqlb.CreateIndex(tableName+"_"+columnName+"_idx", tableName, columnName)
+}
+
+// columnIndexQuery returns the statement creating the index of a model
+// column, using the index method of the column if it has one
+func columnIndexQuery(tableName string, column Column) string {
+	if column.IndexMethod != "" {
+		return sqlb.CreateIndexUsing(tableName+"_"+column.Name+"_idx", tableName, column.IndexMethod, column.Name)
+	}
+	return indexQuery(tableName, column.Name)
+}
+
+// createTableQueries returns the CREATE TABLE statement of a model followed
+// by its index statements
+func createTableQueries(tableName string, modelColumns []Column) []string {
+	var columns []string
+	var indexQueries []string
+	for _, column := range modelColumns {
+		columns = append(columns, columnDefinition(column))
+		if column.Index {
+			indexQueries = append(indexQueries, columnIndexQuery(tableName, column))
 		}
-		columns[columnName] = dataType
 	}
 
-	return columns, nil
+	return append([]string{sqlb.CreateTable(tableName, columns...)}, indexQueries...)
 }
 
-// CreateJoinTable creates a join table for many-to-many relationships
-func CreateJoinTables(db *sql.DB, pairs [][]string) error {
-	for _, tables := range pairs {
-		if len(tables) < 2 {
-			return errors.New("each entry must contain at least two table names")
-		}
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
 
-		joinTableName := strings.Join(tables, "_")
-		var columns []string
-		for _, table := range tables {
-			column := fmt.Sprintf("%s_id INT REFERENCES %s(id)", table, table)
-			columns = append(columns, column)
-		}
+// nullTypes maps the sql.Null* types to their column type
+var nullTypes = map[reflect.Type]string{
+	reflect.TypeOf(sql.NullString{}):  "TEXT",
+	reflect.TypeOf(sql.NullInt16{}):   "SMALLINT",
+	reflect.TypeOf(sql.NullInt32{}):   "INTEGER",
+	reflect.TypeOf(sql.NullInt64{}):   "BIGINT",
+	reflect.TypeOf(sql.NullByte{}):    "SMALLINT",
+	reflect.TypeOf(sql.NullFloat64{}): "DOUBLE PRECISION",
+	reflect.TypeOf(sql.NullBool{}):    "BOOLEAN",
+	reflect.TypeOf(sql.NullTime{}):    "TIMESTAMPTZ",
+}
 
-		primaryKeys := make([]string, len(tables))
-		for i, table := range tables {
-			primaryKeys[i] = fmt.Sprintf("%s_id", table)
-		}
+// serialTypes maps the integer types to the sequence backed type used for
+// primary keys
+var serialTypes = map[string]string{
+	"SMALLINT": "SMALLSERIAL",
+	"INTEGER":  "SERIAL",
+	"BIGINT":   "BIGSERIAL",
+}
 
-		createJoinTableQuery := fmt.Sprintf(`
-			CREATE TABLE IF NOT EXISTS %s (
-				%s,
-				PRIMARY KEY (%s)
-			);
-		`, joinTableName, strings.Join(columns, ", "), strings.Join(primaryKeys, ", "))
+// getColumnType returns the PostgreSQL column type for a given Go type and
+// whether the Go type can hold NULL. It returns an empty type for the types
+// without a column, like slices of models.
+func getColumnType(t reflect.Type) (string, bool) {
+	if t.Kind() == reflect.Ptr {
+		columnType, _ := getColumnType(t.Elem())
+		return columnType, true
+	}
+	if columnType, ok := nullTypes[t]; ok {
+		return columnType, true
+	}
 
-		//log.Println("Executing query:", createJoinTableQuery) // Log the query for debugging
+	switch t {
+	case timeType:
+		return "TIMESTAMPTZ", false
+	case rawMessageType:
+		return "JSONB", true
+	}
 
-		_, err := db.Exec(createJoinTableQuery)
-		if err != nil {
-			return fmt.Errorf("error creating join table %s: %v", joinTableName, err)
+	switch t.Kind() {
+	case reflect.Bool:
+		return "BOOLEAN", false
+	case reflect.Int8, reflect.Int16, reflect.Uint8:
+		return "SMALLINT", false
+	case reflect.Int, reflect.Int32, reflect.Uint16:
+		return "INTEGER", false
+	case reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return "BIGINT", false
+	case reflect.Float32:
+		return "REAL", false
+	case reflect.Float64:
+		return "DOUBLE PRECISION", false
+	case reflect.String:
+		return "TEXT", false
+	case reflect.Map:
+		return "JSONB", true
+	case reflect.Array:
+		// uuid packages define UUID as a [16]byte
+		if t.Name() == "UUID" && t.Len() == 16 && t.Elem().Kind() == reflect.Uint8 {
+			return "UUID", false
+		}
+	case reflect.Slice:
+		switch t.Elem().Kind() {
+		case reflect.Uint8:
+			return "BYTEA", true
+		case reflect.String:
+			return "TEXT[]", true
 		}
-		//log.Printf("Successfully created join table %s.\n", joinTableName)
+		// Handle many-to-many relationship by skipping
+		return "", false
 	}
-	return nil
+	return "", false
 }
@@ -0,0 +1,354 @@
+package helper
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"api-go/sqlb"
+)
+
+// DataDump holds the rows of tables, in an order they can be imported in
+type DataDump struct {
+	Tables []TableDump `json:"tables"`
+}
+
+// TableDump holds the rows of one table, each row listing its values in
+// column order
+type TableDump struct {
+	Name    string          `json:"name"`
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// ImportOptions tunes ImportData
+type ImportOptions struct {
+	// Truncate empties the imported tables first, which must include every
+	// table referencing them
+	Truncate bool
+	// SkipExisting leaves rows conflicting with existing ones alone instead
+	// of failing
+	SkipExisting bool
+}
+
+// dataTable is a table holding data: the table of a registered model or a
+// join table
+type dataTable struct {
+	name    string
+	orderBy []string
+	// serial is the primary key backed by a sequence, if any
+	serial string
+}
+
+// dataTables returns the tables of the registered models in registration
+// order followed by their join tables, so referenced rows come first when
+// models are registered before the models pointing at them
+func dataTables() []dataTable {
+	var tables []dataTable
+	seen := make(map[string]bool)
+
+	metas := RegisteredModels()
+	for _, meta := range metas {
+		table := dataTable{name: meta.Table, orderBy: []string{meta.PrimaryKey.Name}}
+		if isSerialType(meta.PrimaryKey.Type) {
+			table.serial = meta.PrimaryKey.Name
+		}
+		tables = append(tables, table)
+		seen[meta.Table] = true
+	}
+
+	for _, meta := range metas {
+		for _, relation := range meta.Relations {
+			if relation.Kind != ManyToMany || seen[relation.JoinTable] {
+				continue
+			}
+			tables = append(tables, dataTable{name: relation.JoinTable, orderBy: []string{relation.ForeignKey, relation.RefKey}})
+			seen[relation.JoinTable] = true
+		}
+	}
+	return tables
+}
+
+// ExportData reads every row of the given tables, or of every data table
+// when none is given. Binary values are exported base64 encoded, other
+// values in their JSON or PostgreSQL text form. Generated columns are left
+// out, the database computes them again on import.
+func ExportData(db Querier, tables ...string) (*DataDump, error) {
+	selected := dataTables()
+	if len(tables) > 0 {
+		byName := make(map[string]dataTable)
+		for _, table := range selected {
+			byName[table.name] = table
+		}
+
+		selected = nil
+		for _, name := range tables {
+			table, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown table %q", name)
+			}
+			selected = append(selected, table)
+		}
+	}
+
+	dump := &DataDump{}
+	for _, table := range selected {
+		tableDump, err := exportTable(db, table)
+		if err != nil {
+			return nil, err
+		}
+		dump.Tables = append(dump.Tables, *tableDump)
+	}
+	return dump, nil
+}
+
+// exportTable reads the rows of one table
+func exportTable(db Querier, table dataTable) (*TableDump, error) {
+	generated, err := generatedColumns(db, table.name)
+	if err != nil {
+		return nil, fmt.Errorf("error exporting %s: %v", table.name, err)
+	}
+
+	sel := sqlb.Select("*").From(table.name)
+	for _, column := range table.orderBy {
+		sel.OrderBy(column, false)
+	}
+	query, args := sel.Build()
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error exporting %s: %v", table.name, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("error exporting %s: %v", table.name, err)
+	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("error exporting %s: %v", table.name, err)
+	}
+
+	tableDump := &TableDump{Name: table.name, Rows: [][]interface{}{}}
+	for _, column := range columns {
+		if !generated[column] {
+			tableDump.Columns = append(tableDump.Columns, column)
+		}
+	}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("error exporting %s: %v", table.name, err)
+		}
+
+		// the driver returns the text form of types it does not decode
+		row := make([]interface{}, 0, len(tableDump.Columns))
+		for i, value := range values {
+			if generated[columns[i]] {
+				continue
+			}
+			if b, ok := value.([]byte); ok && columnTypes[i].DatabaseTypeName() != "BYTEA" {
+				value = string(b)
+			}
+			row = append(row, value)
+		}
+		tableDump.Rows = append(tableDump.Rows, row)
+	}
+	return tableDump, rows.Err()
+}
+
+// ImportData inserts the rows of a dump in a single transaction and moves
+// the sequences of serial primary keys past the imported ids. It returns
+// the number of rows inserted per table.
+func ImportData(db *sql.DB, dump *DataDump, options ImportOptions) (map[string]int64, error) {
+	known := make(map[string]dataTable)
+	for _, table := range dataTables() {
+		known[table.name] = table
+	}
+
+	var names []string
+	for _, tableDump := range dump.Tables {
+		if _, ok := known[tableDump.Name]; !ok {
+			return nil, fmt.Errorf("unknown table %q", tableDump.Name)
+		}
+		names = append(names, tableDump.Name)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, errors.New("error starting import transaction: " + err.Error())
+	}
+	defer tx.Rollback()
+
+	// without CASCADE, PostgreSQL refuses to empty a table whose rows are
+	// referenced from a table left out of the dump, instead of losing them
+	if options.Truncate && len(names) > 0 {
+		_, err := tx.Exec("TRUNCATE " + sqlb.Idents(names...) + " RESTART IDENTITY")
+		if err != nil {
+			return nil, errors.New("error truncating tables, the dump must hold every table referencing them: " + err.Error())
+		}
+	}
+
+	inserted := make(map[string]int64)
+	for _, tableDump := range dump.Tables {
+		count, err := importTable(tx, tableDump, options)
+		if err != nil {
+			return nil, err
+		}
+		inserted[tableDump.Name] = count
+
+		if serial := known[tableDump.Name].serial; serial != "" {
+			if err := resetSequence(tx, tableDump.Name, serial); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.New("error committing import: " + err.Error())
+	}
+	return inserted, nil
+}
+
+// importTable inserts the rows of one table. Values of generated columns
+// are skipped.
+func importTable(tx *sql.Tx, tableDump TableDump, options ImportOptions) (int64, error) {
+	generated, err := generatedColumns(tx, tableDump.Name)
+	if err != nil {
+		return 0, fmt.Errorf("error importing %s: %v", tableDump.Name, err)
+	}
+	var columns []string
+	for _, column := range tableDump.Columns {
+		if !generated[column] {
+			columns = append(columns, column)
+		}
+	}
+
+	binary, err := binaryColumns(tx, tableDump.Name, columns)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	for i, row := range tableDump.Rows {
+		if len(row) != len(tableDump.Columns) {
+			return count, fmt.Errorf("error importing %s: row %d has %d values for %d columns", tableDump.Name, i+1, len(row), len(tableDump.Columns))
+		}
+
+		values := make([]interface{}, 0, len(columns))
+		for j, value := range row {
+			if generated[tableDump.Columns[j]] {
+				continue
+			}
+			value, err := importValue(value, binary[len(values)])
+			if err != nil {
+				return count, fmt.Errorf("error importing %s: row %d column %s: %v", tableDump.Name, i+1, tableDump.Columns[j], err)
+			}
+			values = append(values, value)
+		}
+
+		insert := sqlb.Insert(tableDump.Name).Columns(columns...).Values(values...)
+		if options.SkipExisting {
+			insert.OnConflictDoNothing()
+		}
+		query, args := insert.Build()
+
+		result, err := tx.Exec(query, args...)
+		if err != nil {
+			return count, fmt.Errorf("error importing %s: row %d: %v", tableDump.Name, i+1, err)
+		}
+		affected, _ := result.RowsAffected()
+		count += affected
+	}
+	return count, nil
+}
+
+// binaryColumns tells for each column of a table whether it is BYTEA,
+// whose values are base64 encoded
+func binaryColumns(tx *sql.Tx, table string, columns []string) ([]bool, error) {
+	binary := make([]bool, len(columns))
+	if len(columns) == 0 {
+		return binary, nil
+	}
+
+	query, args := sqlb.Select(columns...).From(table).Where(sqlb.Expr("false")).Build()
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error importing %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("error importing %s: %v", table, err)
+	}
+	for i, columnType := range columnTypes {
+		binary[i] = columnType.DatabaseTypeName() == "BYTEA"
+	}
+	return binary, nil
+}
+
+// generatedColumns returns the generated columns of a table, such as the
+// search column
+func generatedColumns(db Querier, table string) (map[string]bool, error) {
+	query, args := sqlb.Select("column_name").From("information_schema.columns").
+		Where(sqlb.Expr("table_schema = current_schema()"), sqlb.Eq("table_name", table), sqlb.Eq("is_generated", "ALWAYS")).
+		Build()
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	generated := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		generated[name] = true
+	}
+	return generated, rows.Err()
+}
+
+// importValue converts a decoded JSON value to a query argument. Strings and
+// numbers are sent as text for the server to convert to the column type.
+func importValue(value interface{}, binary bool) (interface{}, error) {
+	switch value := value.(type) {
+	case nil, bool:
+		return value, nil
+	case string:
+		if binary {
+			return base64.StdEncoding.DecodeString(value)
+		}
+		return value, nil
+	case json.Number:
+		return value.String(), nil
+	case float64:
+		return value, nil
+	default:
+		// nested JSON goes to json and jsonb columns as is
+		data, err := json.Marshal(value)
+		return string(data), err
+	}
+}
+
+// resetSequence moves the sequence of a serial column past its largest value
+func resetSequence(tx *sql.Tx, table, column string) error {
+	query, args := sqlb.Select().
+		ColumnExpr("setval(pg_get_serial_sequence(?, ?), COALESCE(MAX("+sqlb.Ident(column)+"), 0) + 1, false)", sqlb.Ident(table), column).
+		From(table).
+		Build()
+	_, err := tx.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("error resetting the sequence of %s.%s: %v", table, column, err)
+	}
+	return nil
+}
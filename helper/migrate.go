@@ -0,0 +1,291 @@
+package helper
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"api-go/sqlb"
+)
+
+// migrationsTable keeps track of the applied migrations
+const migrationsTable = "schema_migrations"
+
+// migrationLockID is the advisory lock key held while a migration runs
+const migrationLockID = 7243001
+
+// Migration is one versioned schema change with its up and down SQL
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus tells whether a migration has been applied and when
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// LoadMigrations reads <version>_<name>.up.sql and <version>_<name>.down.sql
+// files from fsys and returns them sorted by version
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, errors.New("error reading migrations: " + err.Error())
+	}
+
+	byVersion := make(map[int64]*Migration)
+	// files maps a version and direction to the file giving it, 1_init.up.sql
+	// and 0001_init.up.sql are the same migration
+	files := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+
+		version, name, direction, err := parseMigrationFileName(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %v", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("migration version %d is used by both %q and %q", version, migration.Name, name)
+		}
+
+		key := fmt.Sprintf("%d.%s", version, direction)
+		if other, ok := files[key]; ok {
+			return nil, fmt.Errorf("migrations %s and %s are both the %s file of version %d", other, entry.Name(), direction, version)
+		}
+		files[key] = entry.Name()
+
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if strings.TrimSpace(migration.Up) == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// parseMigrationFileName splits 0001_init.up.sql into 1, "init" and "up"
+func parseMigrationFileName(fileName string) (int64, string, string, error) {
+	base := strings.TrimSuffix(fileName, ".sql")
+	direction := path.Ext(base)
+	if direction != ".up" && direction != ".down" {
+		return 0, "", "", fmt.Errorf("migration %s must end with .up.sql or .down.sql", fileName)
+	}
+	base = strings.TrimSuffix(base, direction)
+
+	parts := strings.SplitN(base, "_", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return 0, "", "", fmt.Errorf("migration %s must be named <version>_<name>", fileName)
+	}
+
+	version, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || version <= 0 {
+		return 0, "", "", fmt.Errorf("migration %s has an invalid version", fileName)
+	}
+
+	return version, parts[1], strings.TrimPrefix(direction, "."), nil
+}
+
+// EnsureMigrationsTable creates the schema_migrations table if needed
+func EnsureMigrationsTable(db *sql.DB) error {
+	query := sqlb.CreateTable(migrationsTable,
+		sqlb.ColumnDef("version", "BIGINT", "PRIMARY KEY"),
+		sqlb.ColumnDef("name", "TEXT", "NOT NULL"),
+		sqlb.ColumnDef("applied_at", "TIMESTAMPTZ", "NOT NULL", "DEFAULT now()"),
+	)
+	_, err := db.Exec(query)
+	if err != nil {
+		return errors.New("error creating migrations table: " + err.Error())
+	}
+	return nil
+}
+
+// appliedMigrations returns the applied versions with their apply time. It
+// only reads, so probes may call it with a read-only role: without the
+// schema_migrations table nothing is applied.
+func appliedMigrations(db *sql.DB) (map[int64]time.Time, error) {
+	applied := make(map[int64]time.Time)
+
+	var exists bool
+	query, args := sqlb.Select().ColumnExpr("to_regclass(?) IS NOT NULL", migrationsTable).Build()
+	if err := db.QueryRow(query, args...).Scan(&exists); err != nil {
+		return nil, errors.New("error looking up migrations table: " + err.Error())
+	}
+	if !exists {
+		return applied, nil
+	}
+
+	query, args = sqlb.Select("version", "applied_at").From(migrationsTable).Build()
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, errors.New("error reading applied migrations: " + err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, errors.New("error scanning applied migration: " + err.Error())
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// GetMigrationStatus reports for each migration whether it has been applied
+func GetMigrationStatus(db *sql.DB, migrations []Migration) ([]MigrationStatus, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, migration := range migrations {
+		appliedAt, ok := applied[migration.Version]
+		statuses[i] = MigrationStatus{Migration: migration, Applied: ok, AppliedAt: appliedAt}
+	}
+	return statuses, nil
+}
+
+// PendingMigrations returns the migrations not applied yet, oldest first
+func PendingMigrations(db *sql.DB, migrations []Migration) ([]Migration, error) {
+	statuses, err := GetMigrationStatus(db, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, status := range statuses {
+		if !status.Applied {
+			pending = append(pending, status.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// MigrateUp applies every pending migration and returns how many ran
+func MigrateUp(db *sql.DB, migrations []Migration) (int, error) {
+	if err := EnsureMigrationsTable(db); err != nil {
+		return 0, err
+	}
+	pending, err := PendingMigrations(db, migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, migration := range pending {
+		err := runMigration(db, migration, migration.Up, true)
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(pending), nil
+}
+
+// MigrateDown reverts the last n applied migrations and returns how many ran
+func MigrateDown(db *sql.DB, migrations []Migration, n int) (int, error) {
+	if n <= 0 {
+		return 0, errors.New("number of migrations to revert must be positive")
+	}
+
+	statuses, err := GetMigrationStatus(db, migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	var applied []Migration
+	for i := len(statuses) - 1; i >= 0 && len(applied) < n; i-- {
+		if statuses[i].Applied {
+			applied = append(applied, statuses[i].Migration)
+		}
+	}
+
+	for i, migration := range applied {
+		if strings.TrimSpace(migration.Down) == "" {
+			return i, fmt.Errorf("migration %d_%s has no down file", migration.Version, migration.Name)
+		}
+		err := runMigration(db, migration, migration.Down, false)
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(applied), nil
+}
+
+// runMigration executes one migration and its bookkeeping in a transaction
+func runMigration(db *sql.DB, migration Migration, statements string, up bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.New("error starting migration transaction: " + err.Error())
+	}
+	defer tx.Rollback()
+
+	// serialize concurrent migrators, the lock is released with the transaction
+	query, args := sqlb.Select().ColumnExpr("pg_advisory_xact_lock(?)", migrationLockID).Build()
+	if _, err := tx.Exec(query, args...); err != nil {
+		return errors.New("error acquiring migration lock: " + err.Error())
+	}
+
+	// another process may have run the same migration while we were waiting
+	var applied bool
+	query, args = sqlb.Select().
+		ColumnExpr("EXISTS (SELECT 1 FROM "+sqlb.Ident(migrationsTable)+" WHERE version = ?)", migration.Version).
+		Build()
+	err = tx.QueryRow(query, args...).Scan(&applied)
+	if err != nil {
+		return errors.New("error checking migration state: " + err.Error())
+	}
+	if applied == up {
+		return nil
+	}
+
+	if _, err := tx.Exec(statements); err != nil {
+		return fmt.Errorf("error running migration %d_%s: %v", migration.Version, migration.Name, err)
+	}
+
+	if up {
+		query, args = sqlb.Insert(migrationsTable).Columns("version", "name").Values(migration.Version, migration.Name).Build()
+	} else {
+		query, args = sqlb.Delete(migrationsTable).Where(sqlb.Eq("version", migration.Version)).Build()
+	}
+	_, err = tx.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("error recording migration %d_%s: %v", migration.Version, migration.Name, err)
+	}
+
+	return tx.Commit()
+}
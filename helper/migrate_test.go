@@ -0,0 +1,134 @@
+package helper
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseMigrationFileName(t *testing.T) {
+	tests := []struct {
+		fileName  string
+		version   int64
+		name      string
+		direction string
+		wantErr   string
+	}{
+		{fileName: "0001_init.up.sql", version: 1, name: "init", direction: "up"},
+		{fileName: "0012_add_post_status.down.sql", version: 12, name: "add_post_status", direction: "down"},
+		{fileName: "20240101120000_seed.up.sql", version: 20240101120000, name: "seed", direction: "up"},
+		{fileName: "0001_init.sql", wantErr: "must end with .up.sql or .down.sql"},
+		{fileName: "0001_init.sideways.sql", wantErr: "must end with .up.sql or .down.sql"},
+		{fileName: "0001.up.sql", wantErr: "must be named <version>_<name>"},
+		{fileName: "0001_.up.sql", wantErr: "must be named <version>_<name>"},
+		{fileName: "v1_init.up.sql", wantErr: "has an invalid version"},
+		{fileName: "0000_init.up.sql", wantErr: "has an invalid version"},
+		{fileName: "-1_init.up.sql", wantErr: "has an invalid version"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fileName, func(t *testing.T) {
+			version, name, direction, err := parseMigrationFileName(tt.fileName)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseMigrationFileName(%q) error = %v, want %q", tt.fileName, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseMigrationFileName(%q) error: %v", tt.fileName, err)
+			}
+			if version != tt.version || name != tt.name || direction != tt.direction {
+				t.Errorf("parseMigrationFileName(%q) = %d, %q, %q, want %d, %q, %q",
+					tt.fileName, version, name, direction, tt.version, tt.name, tt.direction)
+			}
+		})
+	}
+}
+
+// migrations are ordered by version, not by file name
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"3_comments.up.sql":       {Data: []byte("CREATE TABLE comment ();")},
+		"0010_tags.up.sql":        {Data: []byte("CREATE TABLE tag ();")},
+		"0002_posts.up.sql":       {Data: []byte("CREATE TABLE post ();")},
+		"0002_posts.down.sql":     {Data: []byte("DROP TABLE post;")},
+		"0001_init.up.sql":        {Data: []byte("SELECT 1;")},
+		"0001_init.down.sql":      {Data: []byte("SELECT 0;")},
+		"README.md":               {Data: []byte("not a migration")},
+		"archive/0003_old.up.sql": {Data: []byte("SELECT 3;")},
+	}
+
+	got, err := LoadMigrations(fsys)
+	if err != nil {
+		t.Fatalf("LoadMigrations() error: %v", err)
+	}
+	want := []Migration{
+		{Version: 1, Name: "init", Up: "SELECT 1;", Down: "SELECT 0;"},
+		{Version: 2, Name: "posts", Up: "CREATE TABLE post ();", Down: "DROP TABLE post;"},
+		{Version: 3, Name: "comments", Up: "CREATE TABLE comment ();"},
+		{Version: 10, Name: "tags", Up: "CREATE TABLE tag ();"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadMigrations() = %+v, want %+v", got, want)
+	}
+}
+
+func TestLoadMigrationsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		fsys    fstest.MapFS
+		wantErr string
+	}{
+		{
+			name:    "missing up file",
+			fsys:    fstest.MapFS{"0001_init.down.sql": {Data: []byte("SELECT 0;")}},
+			wantErr: "migration 1_init has no up file",
+		},
+		{
+			name:    "empty up file",
+			fsys:    fstest.MapFS{"0001_init.up.sql": {Data: []byte("  \n")}},
+			wantErr: "migration 1_init has no up file",
+		},
+		{
+			name: "duplicate up file",
+			fsys: fstest.MapFS{
+				"0001_init.up.sql": {Data: []byte("SELECT 1;")},
+				"1_init.up.sql":    {Data: []byte("SELECT 2;")},
+			},
+			wantErr: "migrations 0001_init.up.sql and 1_init.up.sql are both the up file of version 1",
+		},
+		{
+			name: "duplicate down file",
+			fsys: fstest.MapFS{
+				"0001_init.up.sql":   {Data: []byte("SELECT 1;")},
+				"0001_init.down.sql": {Data: []byte("SELECT 0;")},
+				"01_init.down.sql":   {Data: []byte("SELECT 0;")},
+			},
+			wantErr: "are both the down file of version 1",
+		},
+		{
+			name: "version used twice",
+			fsys: fstest.MapFS{
+				"0001_init.up.sql":  {Data: []byte("SELECT 1;")},
+				"0001_posts.up.sql": {Data: []byte("SELECT 2;")},
+			},
+			wantErr: `migration version 1 is used by both "init" and "posts"`,
+		},
+		{
+			name:    "invalid file name",
+			fsys:    fstest.MapFS{"init.up.sql": {Data: []byte("SELECT 1;")}},
+			wantErr: "must be named <version>_<name>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadMigrations(tt.fsys)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadMigrations() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
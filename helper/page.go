@@ -0,0 +1,100 @@
+package helper
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// page size limits of list endpoints
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// ErrInvalidCursor is returned for a cursor that was not given by the list
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Page is the pagination asked for by a list request: limit with either an
+// offset or a cursor
+type Page struct {
+	Limit  int
+	Offset int
+	// Cursor holds the sort key values of the last row of the previous page
+	Cursor []interface{}
+}
+
+// PageMeta describes a page of a list response
+type PageMeta struct {
+	Total      int     `json:"total"`
+	Limit      int     `json:"limit"`
+	Offset     int     `json:"offset"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+// ParsePage reads the limit, offset and cursor query parameters. A cursor
+// and an offset cannot be combined.
+func ParsePage(r *http.Request) (Page, error) {
+	page := Page{Limit: DefaultPageLimit}
+	query := r.URL.Query()
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > MaxPageLimit {
+			return page, fmt.Errorf("limit must be a number between 1 and %d", MaxPageLimit)
+		}
+		page.Limit = limit
+	}
+
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return page, errors.New("offset must be a positive number")
+		}
+		page.Offset = offset
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		if page.Offset > 0 {
+			return page, errors.New("cursor and offset cannot be combined")
+		}
+		cursor, err := DecodeCursor(value)
+		if err != nil {
+			return page, err
+		}
+		page.Cursor = cursor
+	}
+	return page, nil
+}
+
+// EncodeCursor returns an opaque cursor holding the sort key values of a row
+func EncodeCursor(values ...interface{}) string {
+	data, _ := json.Marshal(values)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor returns the values held by a cursor. Numbers are returned as
+// strings, bound as text they are converted by the database.
+func DecodeCursor(cursor string) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var values []interface{}
+	if err := decoder.Decode(&values); err != nil || len(values) == 0 {
+		return nil, ErrInvalidCursor
+	}
+	for i, value := range values {
+		if number, ok := value.(json.Number); ok {
+			values[i] = number.String()
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,437 @@
+package helper
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"api-go/sqlb"
+)
+
+// ChangeKind describes one difference between a model and its table
+type ChangeKind string
+
+const (
+	ChangeCreateTable ChangeKind = "create table"
+	ChangeAddColumn   ChangeKind = "add column"
+	ChangeRename      ChangeKind = "rename column"
+	ChangeType        ChangeKind = "type mismatch"
+	ChangeNullability ChangeKind = "nullability"
+	ChangeDefault     ChangeKind = "default"
+	ChangeExtraColumn ChangeKind = "column not in model"
+	ChangeForeignKey  ChangeKind = "foreign key"
+	ChangeIndex       ChangeKind = "add index"
+)
+
+// SchemaChange is one planned change with the SQL that would apply it.
+// Changes without SQL have to be handled by a hand written migration.
+type SchemaChange struct {
+	Table       string
+	Column      string
+	Kind        ChangeKind
+	Detail      string
+	SQL         []string
+	Destructive bool
+}
+
+// existingColumn is a column as reported by information_schema
+type existingColumn struct {
+	Name       string
+	DataType   string
+	IsNullable bool
+	Default    sql.NullString
+}
+
+// PlanSchema plans the changes of every model without running them
+func PlanSchema(db *sql.DB, models ...interface{}) ([]SchemaChange, error) {
+	var changes []SchemaChange
+	for _, model := range models {
+		modelChanges, err := PlanTableFromModel(db, model)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, modelChanges...)
+	}
+	return changes, nil
+}
+
+// PlanTableFromModel compares a model with its table and returns the changes
+// needed to bring the table in line, without running them
+func PlanTableFromModel(db *sql.DB, model interface{}) ([]SchemaChange, error) {
+	meta, err := GetModelMeta(model)
+	if err != nil {
+		return nil, err
+	}
+
+	existingColumns, err := getExistingColumns(db, meta.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(existingColumns) == 0 {
+		return []SchemaChange{{
+			Table: meta.Table,
+			Kind:  ChangeCreateTable,
+			SQL:   createTableQueries(meta.Table, meta.SchemaColumns()),
+		}}, nil
+	}
+
+	return diffColumns(meta.Table, meta.SchemaColumns(), existingColumns), nil
+}
+
+// diffColumns compares the model columns of a table with the existing ones
+func diffColumns(tableName string, modelColumns []Column, existingColumns map[string]existingColumn) []SchemaChange {
+	var changes []SchemaChange
+	inModel := make(map[string]bool)
+
+	for _, column := range modelColumns {
+		inModel[column.Name] = true
+
+		existing, exists := existingColumns[column.Name]
+		if !exists && column.Was != "" {
+			// rename instead of adding an empty column next to the old one
+			existing, exists = existingColumns[column.Was]
+			if exists {
+				inModel[column.Was] = true
+				changes = append(changes, SchemaChange{
+					Table:  tableName,
+					Column: column.Name,
+					Kind:   ChangeRename,
+					Detail: fmt.Sprintf("%s -> %s", column.Was, column.Name),
+					SQL:    []string{sqlb.AlterTable(tableName, "RENAME COLUMN "+sqlb.Ident(column.Was)+" TO "+sqlb.Ident(column.Name))},
+				})
+			}
+		}
+		if !exists {
+			queries := []string{sqlb.AlterTable(tableName, "ADD COLUMN "+columnDefinition(column))}
+			if column.Index {
+				queries = append(queries, columnIndexQuery(tableName, column))
+			}
+			changes = append(changes, SchemaChange{
+				Table:  tableName,
+				Column: column.Name,
+				Kind:   ChangeAddColumn,
+				Detail: column.Type,
+				SQL:    queries,
+			})
+			continue
+		}
+
+		wantType := normalizeColumnType(column.Type)
+		if wantType != existing.DataType {
+			change := SchemaChange{
+				Table:  tableName,
+				Column: column.Name,
+				Kind:   ChangeType,
+				Detail: fmt.Sprintf("%s -> %s", existing.DataType, wantType),
+			}
+			if isSafeCast(existing.DataType, wantType) {
+				change.SQL = []string{sqlb.AlterTable(tableName, fmt.Sprintf("ALTER COLUMN %s TYPE %s USING %s",
+					sqlb.Ident(column.Name), wantType, castExpression(sqlb.Ident(column.Name), existing.DataType, wantType)))}
+			}
+			changes = append(changes, change)
+		}
+
+		wantNotNull := column.NotNull || column.PrimaryKey
+		if wantNotNull == existing.IsNullable {
+			change := SchemaChange{Table: tableName, Column: column.Name, Kind: ChangeNullability}
+			if wantNotNull {
+				change.Detail = "NULL -> NOT NULL"
+				change.SQL = []string{sqlb.AlterTable(tableName, "ALTER COLUMN "+sqlb.Ident(column.Name)+" SET NOT NULL")}
+			} else {
+				change.Detail = "NOT NULL -> NULL"
+				change.SQL = []string{sqlb.AlterTable(tableName, "ALTER COLUMN "+sqlb.Ident(column.Name)+" DROP NOT NULL")}
+			}
+			changes = append(changes, change)
+		}
+
+		// serial columns own their sequence default
+		if isSerialType(column.Type) {
+			continue
+		}
+		existingDefault := normalizeDefault(existing.Default.String)
+		if normalizeDefault(column.Default) != existingDefault {
+			change := SchemaChange{
+				Table:  tableName,
+				Column: column.Name,
+				Kind:   ChangeDefault,
+				Detail: fmt.Sprintf("%s -> %s", describeDefault(existingDefault), describeDefault(column.Default)),
+			}
+			if column.Default == "" {
+				change.SQL = []string{sqlb.AlterTable(tableName, "ALTER COLUMN "+sqlb.Ident(column.Name)+" DROP DEFAULT")}
+			} else {
+				change.SQL = []string{sqlb.AlterTable(tableName, "ALTER COLUMN "+sqlb.Ident(column.Name)+" SET DEFAULT "+column.Default)}
+			}
+			changes = append(changes, change)
+		}
+	}
+
+	var extraColumns []string
+	for name := range existingColumns {
+		if !inModel[name] {
+			extraColumns = append(extraColumns, name)
+		}
+	}
+	sort.Strings(extraColumns)
+	for _, name := range extraColumns {
+		changes = append(changes, SchemaChange{
+			Table:       tableName,
+			Column:      name,
+			Kind:        ChangeExtraColumn,
+			Detail:      existingColumns[name].DataType,
+			SQL:         []string{sqlb.AlterTable(tableName, "DROP COLUMN "+sqlb.Ident(name))},
+			Destructive: true,
+		})
+	}
+
+	return changes
+}
+
+// ApplySchemaChanges runs the SQL of the planned changes, skipping the
+// destructive ones
+func ApplySchemaChanges(db *sql.DB, changes []SchemaChange) error {
+	for _, change := range changes {
+		if change.Destructive {
+			continue
+		}
+		for _, query := range change.SQL {
+			_, err := db.Exec(query)
+			if err != nil {
+				return fmt.Errorf("error executing query %s: %v", query, err)
+			}
+		}
+	}
+	return nil
+}
+
+// FormatSchemaPlan renders the changes as a readable report followed by the
+// SQL plan. Destructive statements and manual changes are commented out.
+func FormatSchemaPlan(changes []SchemaChange) string {
+	if len(changes) == 0 {
+		return "-- schema is up to date\n"
+	}
+
+	var b strings.Builder
+	b.WriteString("-- changes\n")
+	for _, change := range changes {
+		target := change.Table
+		if change.Column != "" {
+			target += "." + change.Column
+		}
+		line := fmt.Sprintf("--   %-28s %s", target, change.Kind)
+		if change.Detail != "" {
+			line += ": " + change.Detail
+		}
+		if len(change.SQL) == 0 {
+			line += " (manual migration required)"
+		} else if change.Destructive {
+			line += " (destructive, not applied automatically)"
+		}
+		b.WriteString(line + "\n")
+	}
+
+	b.WriteString("\n-- SQL plan\n")
+	for _, change := range changes {
+		for _, query := range change.SQL {
+			if change.Destructive {
+				b.WriteString("-- ")
+			}
+			b.WriteString(query + "\n")
+		}
+	}
+	return b.String()
+}
+
+// getExistingColumns retrieves the existing columns of a table from the database
+func getExistingColumns(db *sql.DB, tableName string) (map[string]existingColumn, error) {
+	query, args := sqlb.Select("column_name", "data_type", "udt_name", "character_maximum_length",
+		"numeric_precision", "numeric_scale", "is_nullable", "column_default").
+		From("information_schema.columns").
+		Where(sqlb.Expr("table_schema = current_schema()"), sqlb.Eq("table_name", tableName)).
+		Build()
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying existing columns: %v", err)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]existingColumn)
+	for rows.Next() {
+		var column existingColumn
+		var dataType, udtName, isNullable string
+		var maxLength, precision, scale sql.NullInt64
+		err := rows.Scan(&column.Name, &dataType, &udtName, &maxLength, &precision, &scale, &isNullable, &column.Default)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+
+		column.DataType = existingColumnType(dataType, udtName, maxLength, precision, scale)
+		column.IsNullable = isNullable == "YES"
+		columns[column.Name] = column
+	}
+
+	return columns, rows.Err()
+}
+
+// existingColumnType rebuilds a full type name from information_schema fields
+func existingColumnType(dataType, udtName string, maxLength, precision, scale sql.NullInt64) string {
+	switch dataType {
+	case "ARRAY":
+		return normalizeColumnType(strings.TrimPrefix(udtName, "_")) + "[]"
+	case "USER-DEFINED":
+		return udtName
+	case "character varying", "character":
+		if maxLength.Valid {
+			return fmt.Sprintf("%s(%d)", dataType, maxLength.Int64)
+		}
+	case "numeric":
+		if precision.Valid && scale.Valid {
+			return fmt.Sprintf("numeric(%d,%d)", precision.Int64, scale.Int64)
+		}
+	}
+	return dataType
+}
+
+var typeAliases = map[string]string{
+	"serial":      "integer",
+	"serial4":     "integer",
+	"int":         "integer",
+	"int4":        "integer",
+	"bigserial":   "bigint",
+	"serial8":     "bigint",
+	"int8":        "bigint",
+	"smallserial": "smallint",
+	"serial2":     "smallint",
+	"int2":        "smallint",
+	"varchar":     "character varying",
+	"char":        "character",
+	"bpchar":      "character",
+	"bool":        "boolean",
+	"float8":      "double precision",
+	"float4":      "real",
+	"decimal":     "numeric",
+	"timestamp":   "timestamp without time zone",
+	"timestamptz": "timestamp with time zone",
+	"time":        "time without time zone",
+	"timetz":      "time with time zone",
+}
+
+// normalizeColumnType maps a declared SQL type to the spelling used by
+// information_schema, e.g. varchar(200) to character varying(200)
+func normalizeColumnType(sqlType string) string {
+	t := strings.Join(strings.Fields(strings.ToLower(sqlType)), " ")
+
+	if strings.HasSuffix(t, "[]") {
+		return normalizeColumnType(strings.TrimSuffix(t, "[]")) + "[]"
+	}
+
+	base, args := t, ""
+	if i := strings.Index(t, "("); i >= 0 {
+		base, args = strings.TrimSpace(t[:i]), strings.ReplaceAll(t[i:], " ", "")
+	}
+	if alias, ok := typeAliases[base]; ok {
+		base = alias
+	}
+	return base + args
+}
+
+// safeCasts lists the type changes that never lose data nor fail on
+// existing rows. Any type can also become text. Dates and timestamps only
+// gain a time zone through castExpression, which reads them as UTC.
+var safeCasts = map[string][]string{
+	"smallint":                    {"integer", "bigint", "numeric", "real", "double precision"},
+	"integer":                     {"bigint", "numeric", "double precision"},
+	"bigint":                      {"numeric"},
+	"real":                        {"double precision"},
+	"date":                        {"timestamp without time zone", "timestamp with time zone"},
+	"timestamp without time zone": {"timestamp with time zone"},
+	"json":                        {"jsonb"},
+}
+
+// isSafeCast tells whether a column of type from can be altered to type to
+// with a plain cast
+func isSafeCast(from, to string) bool {
+	if to == "text" {
+		return true
+	}
+
+	fromBase, fromLength := splitTypeLength(from)
+	toBase, toLength := splitTypeLength(to)
+	if fromBase == "character varying" || fromBase == "character" {
+		// widening a varchar, or dropping its limit, keeps every value
+		if toBase == "character varying" && (toLength == 0 || (fromLength > 0 && toLength >= fromLength)) {
+			return true
+		}
+	}
+
+	for _, target := range safeCasts[from] {
+		if target == to {
+			return true
+		}
+	}
+	return false
+}
+
+// castExpression is the USING expression that converts column from one type
+// to another. A plain cast to timestamp with time zone would read the stored
+// values in the session time zone, so they are taken as UTC instead.
+func castExpression(column, from, to string) string {
+	if to == "timestamp with time zone" {
+		switch from {
+		case "timestamp without time zone":
+			return column + " AT TIME ZONE 'UTC'"
+		case "date":
+			return column + "::timestamp AT TIME ZONE 'UTC'"
+		}
+	}
+	return column + "::" + to
+}
+
+// splitTypeLength splits character varying(200) into its base and length
+func splitTypeLength(sqlType string) (string, int) {
+	i := strings.Index(sqlType, "(")
+	if i < 0 {
+		return sqlType, 0
+	}
+	length, err := strconv.Atoi(strings.TrimSuffix(sqlType[i+1:], ")"))
+	if err != nil {
+		return sqlType, 0
+	}
+	return sqlType[:i], length
+}
+
+// isSerialType tells whether a declared type creates its own sequence
+func isSerialType(sqlType string) bool {
+	switch strings.ToLower(sqlType) {
+	case "serial", "bigserial", "smallserial", "serial2", "serial4", "serial8":
+		return true
+	}
+	return false
+}
+
+var defaultCast = regexp.MustCompile(`^(.*?)::[a-z ]+(\(\d+(,\d+)?\))?(\[\])?$`)
+
+// normalizeDefault strips the casts Postgres adds to stored defaults, so
+// 'Draft'::character varying compares equal to 'Draft'
+func normalizeDefault(expr string) string {
+	expr = strings.TrimSpace(expr)
+	if match := defaultCast.FindStringSubmatch(expr); match != nil {
+		expr = match[1]
+	}
+	// keep string literals as they are, only function names are case insensitive
+	if strings.Contains(expr, "'") {
+		return expr
+	}
+	return strings.ToLower(expr)
+}
+
+// describeDefault prints an empty default as "none"
+func describeDefault(expr string) string {
+	if expr == "" {
+		return "none"
+	}
+	return expr
+}
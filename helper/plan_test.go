@@ -0,0 +1,230 @@
+package helper
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeColumnType(t *testing.T) {
+	tests := []struct {
+		sqlType, want string
+	}{
+		{"INTEGER", "integer"},
+		{"SERIAL", "integer"},
+		{"BIGSERIAL", "bigint"},
+		{"int8", "bigint"},
+		{"VARCHAR(200)", "character varying(200)"},
+		{"varchar ( 200 )", "character varying(200)"},
+		{"NUMERIC(10, 2)", "numeric(10,2)"},
+		{"decimal(10,2)", "numeric(10,2)"},
+		{"TIMESTAMPTZ", "timestamp with time zone"},
+		{"timestamp", "timestamp without time zone"},
+		{"Double  Precision", "double precision"},
+		{"TEXT[]", "text[]"},
+		{"varchar(20)[]", "character varying(20)[]"},
+		{"uuid", "uuid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sqlType, func(t *testing.T) {
+			if got := normalizeColumnType(tt.sqlType); got != tt.want {
+				t.Errorf("normalizeColumnType(%q) = %q, want %q", tt.sqlType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeDefault(t *testing.T) {
+	tests := []struct {
+		expr, want string
+	}{
+		{"", ""},
+		{"'Draft'::character varying", "'Draft'"},
+		{"'Draft'", "'Draft'"},
+		{"' Mixed Case '::text", "' Mixed Case '"},
+		{"NOW()", "now()"},
+		{"now()", "now()"},
+		{"0", "0"},
+		{"'{}'::character varying(20)[]", "'{}'"},
+		{"0::numeric(10,2)", "0"},
+		{"  TRUE ", "true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			if got := normalizeDefault(tt.expr); got != tt.want {
+				t.Errorf("normalizeDefault(%q) = %q, want %q", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsSafeCast(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{"integer", "bigint", true},
+		{"smallint", "double precision", true},
+		{"bigint", "integer", false},
+		{"numeric", "integer", false},
+		{"jsonb", "text", true},
+		{"json", "jsonb", true},
+		{"jsonb", "json", false},
+		{"character varying(100)", "character varying(200)", true},
+		{"character varying(200)", "character varying(100)", false},
+		{"character varying(200)", "character varying", true},
+		{"character varying", "character varying(200)", false},
+		{"character(10)", "character varying(10)", true},
+		{"text", "character varying(200)", false},
+		{"date", "timestamp without time zone", true},
+		{"date", "timestamp with time zone", true},
+		{"timestamp without time zone", "timestamp with time zone", true},
+		{"timestamp with time zone", "timestamp without time zone", false},
+		{"timestamp without time zone", "date", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+" -> "+tt.to, func(t *testing.T) {
+			if got := isSafeCast(tt.from, tt.to); got != tt.want {
+				t.Errorf("isSafeCast(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffColumns(t *testing.T) {
+	existing := func(name, dataType string, nullable bool, def string) existingColumn {
+		return existingColumn{Name: name, DataType: dataType, IsNullable: nullable, Default: sql.NullString{String: def, Valid: def != ""}}
+	}
+	id := Column{Name: "id", Type: "SERIAL", PrimaryKey: true}
+	existingID := existing("id", "integer", false, `nextval('t_id_seq'::regclass)`)
+
+	tests := []struct {
+		name     string
+		columns  []Column
+		existing []existingColumn
+		want     []SchemaChange
+	}{
+		{
+			name:     "up to date",
+			columns:  []Column{id, {Name: "status", Type: "VARCHAR(20)", NotNull: true, Default: "'Draft'"}},
+			existing: []existingColumn{existingID, existing("status", "character varying(20)", false, "'Draft'::character varying")},
+		},
+		{
+			name:     "add column",
+			columns:  []Column{id, {Name: "title", Type: "TEXT", NotNull: true, Index: true}},
+			existing: []existingColumn{existingID},
+			want: []SchemaChange{{
+				Table: "t", Column: "title", Kind: ChangeAddColumn, Detail: "TEXT",
+				SQL: []string{
+					`ALTER TABLE "t" ADD COLUMN "title" TEXT NOT NULL;`,
+					`CREATE INDEX IF NOT EXISTS "t_title_idx" ON "t" ("title");`,
+				},
+			}},
+		},
+		{
+			name:     "rename column",
+			columns:  []Column{id, {Name: "title", Type: "TEXT", Was: "headline"}},
+			existing: []existingColumn{existingID, existing("headline", "text", true, "")},
+			want: []SchemaChange{{
+				Table: "t", Column: "title", Kind: ChangeRename, Detail: "headline -> title",
+				SQL: []string{`ALTER TABLE "t" RENAME COLUMN "headline" TO "title";`},
+			}},
+		},
+		{
+			name:     "safe type change",
+			columns:  []Column{id, {Name: "views", Type: "BIGINT"}},
+			existing: []existingColumn{existingID, existing("views", "integer", true, "")},
+			want: []SchemaChange{{
+				Table: "t", Column: "views", Kind: ChangeType, Detail: "integer -> bigint",
+				SQL: []string{`ALTER TABLE "t" ALTER COLUMN "views" TYPE bigint USING "views"::bigint;`},
+			}},
+		},
+		{
+			name:     "timestamp read as UTC",
+			columns:  []Column{id, {Name: "publishdate", Type: "TIMESTAMPTZ"}},
+			existing: []existingColumn{existingID, existing("publishdate", "timestamp without time zone", true, "")},
+			want: []SchemaChange{{
+				Table: "t", Column: "publishdate", Kind: ChangeType, Detail: "timestamp without time zone -> timestamp with time zone",
+				SQL: []string{`ALTER TABLE "t" ALTER COLUMN "publishdate" TYPE timestamp with time zone USING "publishdate" AT TIME ZONE 'UTC';`},
+			}},
+		},
+		{
+			name:     "date read as UTC",
+			columns:  []Column{id, {Name: "publishdate", Type: "TIMESTAMPTZ"}},
+			existing: []existingColumn{existingID, existing("publishdate", "date", true, "")},
+			want: []SchemaChange{{
+				Table: "t", Column: "publishdate", Kind: ChangeType, Detail: "date -> timestamp with time zone",
+				SQL: []string{`ALTER TABLE "t" ALTER COLUMN "publishdate" TYPE timestamp with time zone USING "publishdate"::timestamp AT TIME ZONE 'UTC';`},
+			}},
+		},
+		{
+			name:     "narrowing needs a migration",
+			columns:  []Column{id, {Name: "title", Type: "VARCHAR(100)"}},
+			existing: []existingColumn{existingID, existing("title", "character varying(200)", true, "")},
+			want: []SchemaChange{{
+				Table: "t", Column: "title", Kind: ChangeType, Detail: "character varying(200) -> character varying(100)",
+			}},
+		},
+		{
+			name:     "nullability",
+			columns:  []Column{id, {Name: "title", Type: "TEXT", NotNull: true}, {Name: "content", Type: "TEXT"}},
+			existing: []existingColumn{existingID, existing("title", "text", true, ""), existing("content", "text", false, "")},
+			want: []SchemaChange{
+				{
+					Table: "t", Column: "title", Kind: ChangeNullability, Detail: "NULL -> NOT NULL",
+					SQL: []string{`ALTER TABLE "t" ALTER COLUMN "title" SET NOT NULL;`},
+				},
+				{
+					Table: "t", Column: "content", Kind: ChangeNullability, Detail: "NOT NULL -> NULL",
+					SQL: []string{`ALTER TABLE "t" ALTER COLUMN "content" DROP NOT NULL;`},
+				},
+			},
+		},
+		{
+			name:     "defaults",
+			columns:  []Column{id, {Name: "status", Type: "TEXT", Default: "'Draft'"}, {Name: "content", Type: "TEXT"}},
+			existing: []existingColumn{existingID, existing("status", "text", true, "'draft'::text"), existing("content", "text", true, "''::text")},
+			want: []SchemaChange{
+				{
+					Table: "t", Column: "status", Kind: ChangeDefault, Detail: "'draft' -> 'Draft'",
+					SQL: []string{`ALTER TABLE "t" ALTER COLUMN "status" SET DEFAULT 'Draft';`},
+				},
+				{
+					Table: "t", Column: "content", Kind: ChangeDefault, Detail: "'' -> none",
+					SQL: []string{`ALTER TABLE "t" ALTER COLUMN "content" DROP DEFAULT;`},
+				},
+			},
+		},
+		{
+			name:     "extra columns are destructive",
+			columns:  []Column{id},
+			existing: []existingColumn{existingID, existing("zeta", "text", true, ""), existing("alpha", "integer", true, "")},
+			want: []SchemaChange{
+				{
+					Table: "t", Column: "alpha", Kind: ChangeExtraColumn, Detail: "integer",
+					SQL: []string{`ALTER TABLE "t" DROP COLUMN "alpha";`}, Destructive: true,
+				},
+				{
+					Table: "t", Column: "zeta", Kind: ChangeExtraColumn, Detail: "text",
+					SQL: []string{`ALTER TABLE "t" DROP COLUMN "zeta";`}, Destructive: true,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			existingColumns := make(map[string]existingColumn)
+			for _, column := range tt.existing {
+				existingColumns[column.Name] = column
+			}
+			got := diffColumns("t", tt.columns, existingColumns)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffColumns() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
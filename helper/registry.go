@@ -0,0 +1,384 @@
+package helper
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/lib/pq"
+)
+
+// Tabler is implemented by models choosing their own table name
+type Tabler interface {
+	TableName() string
+}
+
+// ModelMeta is the metadata of a model, read once from its struct tags
+type ModelMeta struct {
+	Type       reflect.Type
+	Table      string
+	Columns    []Column
+	PrimaryKey Column
+	Relations  []Relation
+	// Search is the full text search column, nil when no column has a
+	// search weight
+	Search *SearchIndex
+}
+
+// registry caches the metadata of every model seen, and keeps the order of
+// the models registered as tables
+var registry = struct {
+	sync.RWMutex
+	metas      map[reflect.Type]*ModelMeta
+	registered []reflect.Type
+}{metas: make(map[reflect.Type]*ModelMeta)}
+
+// RegisterModels adds models to the registry. The registered models are the
+// tables managed by the schema commands, in registration order.
+func RegisterModels(models ...interface{}) error {
+	for _, model := range models {
+		meta, err := GetModelMeta(model)
+		if err != nil {
+			return err
+		}
+
+		registry.Lock()
+		known := false
+		for _, t := range registry.registered {
+			known = known || t == meta.Type
+		}
+		if !known {
+			registry.registered = append(registry.registered, meta.Type)
+		}
+		registry.Unlock()
+	}
+	return nil
+}
+
+// RegisteredModels returns the metadata of the registered models
+func RegisteredModels() []*ModelMeta {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	metas := make([]*ModelMeta, len(registry.registered))
+	for i, t := range registry.registered {
+		metas[i] = registry.metas[t]
+	}
+	return metas
+}
+
+// GetModelMeta returns the metadata of a model, reading it on first use. The
+// model may be a struct, a pointer to one or its reflect.Type.
+func GetModelMeta(model interface{}) (*ModelMeta, error) {
+	modelType, ok := model.(reflect.Type)
+	if !ok {
+		modelType = reflect.TypeOf(model)
+	}
+	if modelType == nil {
+		return nil, errors.New("model is nil")
+	}
+	if modelType.Kind() == reflect.Ptr {
+		modelType = modelType.Elem()
+	}
+	if modelType.Kind() != reflect.Struct {
+		return nil, errors.New("model is not a struct")
+	}
+
+	registry.RLock()
+	meta, ok := registry.metas[modelType]
+	registry.RUnlock()
+	if ok {
+		return meta, nil
+	}
+
+	meta, err := readModelMeta(modelType)
+	if err != nil {
+		return nil, err
+	}
+
+	registry.Lock()
+	registry.metas[modelType] = meta
+	registry.Unlock()
+	return meta, nil
+}
+
+// ColumnNames returns the column names in field order
+func (meta *ModelMeta) ColumnNames() []string {
+	names := make([]string, len(meta.Columns))
+	for i, column := range meta.Columns {
+		names[i] = column.Name
+	}
+	return names
+}
+
+// SchemaColumns returns the columns of the model table: the model columns
+// followed by the generated search column, if any
+func (meta *ModelMeta) SchemaColumns() []Column {
+	if meta.Search == nil {
+		return meta.Columns
+	}
+	columns := append([]Column{}, meta.Columns...)
+	return append(columns, meta.Search.column())
+}
+
+// SortColumn returns the sortable column sorted by name
+func (meta *ModelMeta) SortColumn(name string) (Column, bool) {
+	for _, column := range meta.Columns {
+		if column.Sortable && column.SortKey() == name {
+			return column, true
+		}
+	}
+	return Column{}, false
+}
+
+// Relation returns the relation declared on a field
+func (meta *ModelMeta) Relation(field string) (Relation, bool) {
+	for _, relation := range meta.Relations {
+		if relation.Field == field {
+			return relation, true
+		}
+	}
+	return Relation{}, false
+}
+
+// ScanDest returns the scan destinations of every column of a model, in
+// column order. model must be a pointer to a struct of this model.
+func (meta *ModelMeta) ScanDest(model interface{}) []interface{} {
+	v := reflect.ValueOf(model).Elem()
+	dest := make([]interface{}, len(meta.Columns))
+	for i, column := range meta.Columns {
+		dest[i] = scanTarget(v.FieldByIndex(column.FieldIndex))
+	}
+	return dest
+}
+
+// tableName returns the TableName() of a model, or its lower cased type name
+func tableName(modelType reflect.Type) string {
+	if tabler, ok := reflect.New(modelType).Interface().(Tabler); ok {
+		return tabler.TableName()
+	}
+	return strings.ToLower(modelType.Name())
+}
+
+// readModelMeta reads the columns and relations of a model. Without an
+// explicit pk option the id column is the primary key.
+func readModelMeta(modelType reflect.Type) (*ModelMeta, error) {
+	meta := &ModelMeta{Type: modelType, Table: tableName(modelType)}
+
+	var inferred []bool
+	err := readColumns(meta, modelType, nil, &inferred)
+	if err != nil {
+		return nil, fmt.Errorf("model %s: %v", modelType.Name(), err)
+	}
+
+	primaryKey := -1
+	for i, column := range meta.Columns {
+		if column.PrimaryKey {
+			if primaryKey >= 0 {
+				return nil, fmt.Errorf("model %s: more than one primary key defined", modelType.Name())
+			}
+			primaryKey = i
+		}
+	}
+	if primaryKey < 0 {
+		for i, column := range meta.Columns {
+			if column.Name == "id" {
+				meta.Columns[i].PrimaryKey = true
+				primaryKey = i
+			}
+		}
+	}
+	if primaryKey < 0 {
+		return nil, fmt.Errorf("model %s: primary key not defined", modelType.Name())
+	}
+
+	// only an integer primary key is backed by a sequence
+	if serialType, ok := serialTypes[meta.Columns[primaryKey].Type]; ok && inferred[primaryKey] {
+		meta.Columns[primaryKey].Type = serialType
+	}
+	meta.PrimaryKey = meta.Columns[primaryKey]
+	meta.Search = readSearchIndex(meta)
+
+	return meta, nil
+}
+
+// readColumns appends the columns and relations of the fields of t, walking
+// into embedded structs. Value fields are NOT NULL, pointer and sql.Null*
+// fields are nullable, unless the tag says otherwise.
+func readColumns(meta *ModelMeta, t reflect.Type, index []int, inferred *[]bool) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fieldIndex := append(append([]int{}, index...), i)
+
+		if tag, ok := field.Tag.Lookup("rel"); ok {
+			relation, err := parseRelationTag(meta.Type, field, tag)
+			if err != nil {
+				return err
+			}
+			meta.Relations = append(meta.Relations, relation)
+			continue
+		}
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Type != timeType && field.Tag.Get("db") == "" {
+			err := readColumns(meta, field.Type, fieldIndex, inferred)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+
+		column, err := parseColumnTag(field)
+		if err != nil {
+			return err
+		}
+		if column.Skip {
+			continue
+		}
+
+		columnType, nullable := getColumnType(field.Type)
+		if column.Type == "" && columnType == "" {
+			continue
+		}
+		*inferred = append(*inferred, column.Type == "")
+		if column.Type == "" {
+			column.Type = columnType
+		}
+		if !nullable && !column.Null {
+			column.NotNull = true
+		}
+
+		for _, existing := range meta.Columns {
+			if existing.Name == column.Name {
+				return fmt.Errorf("column %s is declared twice", column.Name)
+			}
+		}
+		column.FieldIndex = fieldIndex
+		meta.Columns = append(meta.Columns, column)
+	}
+	return nil
+}
+
+// scanTarget returns what to pass to Scan for a field. Value fields of
+// nullable columns read NULL as their zero value, string slices go through
+// pq arrays and maps through JSON.
+func scanTarget(field reflect.Value) interface{} {
+	ptr := field.Addr().Interface()
+	switch field.Kind() {
+	case reflect.Ptr:
+		return ptr
+	case reflect.Map:
+		return jsonColumn{field}
+	case reflect.Slice:
+		if field.Type().Elem().Kind() == reflect.String {
+			return pq.Array(ptr)
+		}
+		return ptr
+	}
+	if _, ok := ptr.(sql.Scanner); ok {
+		return ptr
+	}
+	return nullScanner{field}
+}
+
+// fieldValue returns the value bound for the field of a column, the
+// counterpart of scanTarget: the zero value of a value field binds NULL when
+// the column is nullable
+func fieldValue(column Column, field reflect.Value) interface{} {
+	if column.Null && field.Kind() != reflect.Ptr && field.IsZero() {
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.Map:
+		return jsonColumn{field}
+	case reflect.Slice:
+		if field.Type().Elem().Kind() == reflect.String {
+			return pq.Array(field.Interface())
+		}
+	}
+	return field.Interface()
+}
+
+// nullScanner scans NULL as the zero value of a value field
+type nullScanner struct {
+	field reflect.Value
+}
+
+func (s nullScanner) Scan(src interface{}) error {
+	if src == nil {
+		s.field.Set(reflect.Zero(s.field.Type()))
+		return nil
+	}
+
+	var err error
+	switch s.field.Kind() {
+	case reflect.String:
+		var v sql.NullString
+		err = v.Scan(src)
+		s.field.SetString(v.String)
+	case reflect.Bool:
+		var v sql.NullBool
+		err = v.Scan(src)
+		s.field.SetBool(v.Bool)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var v sql.NullInt64
+		err = v.Scan(src)
+		s.field.SetInt(v.Int64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var v sql.NullInt64
+		err = v.Scan(src)
+		s.field.SetUint(uint64(v.Int64))
+	case reflect.Float32, reflect.Float64:
+		var v sql.NullFloat64
+		err = v.Scan(src)
+		s.field.SetFloat(v.Float64)
+	default:
+		if s.field.Type() == timeType {
+			var v sql.NullTime
+			err = v.Scan(src)
+			s.field.Set(reflect.ValueOf(v.Time))
+			break
+		}
+		value := reflect.ValueOf(src)
+		if !value.Type().ConvertibleTo(s.field.Type()) {
+			return fmt.Errorf("cannot scan %T into %s", src, s.field.Type())
+		}
+		s.field.Set(value.Convert(s.field.Type()))
+	}
+	return err
+}
+
+// jsonColumn reads and writes a map field as JSON
+type jsonColumn struct {
+	field reflect.Value
+}
+
+func (c jsonColumn) Scan(src interface{}) error {
+	var data []byte
+	switch src := src.(type) {
+	case nil:
+		c.field.Set(reflect.Zero(c.field.Type()))
+		return nil
+	case []byte:
+		data = src
+	case string:
+		data = []byte(src)
+	default:
+		return fmt.Errorf("cannot scan %T into %s", src, c.field.Type())
+	}
+	return json.Unmarshal(data, c.field.Addr().Interface())
+}
+
+func (c jsonColumn) Value() (driver.Value, error) {
+	if c.field.IsNil() {
+		return nil, nil
+	}
+	return json.Marshal(c.field.Interface())
+}
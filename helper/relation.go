@@ -0,0 +1,458 @@
+package helper
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"api-go/sqlb"
+)
+
+// RelationKind is the kind of relation declared by a rel tag
+type RelationKind string
+
+const (
+	ManyToMany RelationKind = "many2many"
+	HasMany    RelationKind = "has_many"
+	BelongsTo  RelationKind = "belongs_to"
+)
+
+// Relation is a relation between two models declared with a `rel:"..."`
+// struct tag. The first element is the kind, the remaining are options:
+//
+//	Tags   []Tag  `rel:"many2many,join=post_tag,fk=post_id,ref_fk=tag_id,on_delete=cascade"`
+//	Posts  []Post `rel:"has_many,fk=author_id,on_delete=set null"`
+//	Author *User  `rel:"belongs_to,fk=author_id,on_delete=restrict"`
+//
+// Every option defaults to the <table>_<table> and <table>_id conventions,
+// on_delete defaults to no action. A many2many relation can carry payload
+// columns on its join rows, written in the db tag syntax and separated by
+// semicolons:
+//
+//	`payload:"position,type=integer,notnull,default=0;created_at,type=timestamptz,default=now()"`
+type Relation struct {
+	Kind  RelationKind
+	Field string
+	// Table is the model declaring the relation, RefTable the related model
+	Table    string
+	RefTable string
+	// JoinTable holds the pairs of a many2many relation
+	JoinTable string
+	// ForeignKey is the column pointing at Table, except for belongs_to
+	// where it is the column of Table pointing at RefTable
+	ForeignKey string
+	// RefKey is the join table column pointing at RefTable
+	RefKey string
+	// OnDelete is the ON DELETE action of the foreign keys, e.g. CASCADE
+	OnDelete string
+	// payload are the extra columns of the join rows
+	payload []Column
+	// model declares the relation and refModel is the related model, their
+	// primary keys are the referenced columns
+	model    reflect.Type
+	refModel reflect.Type
+}
+
+// onDeleteActions maps rel tag values and pg_constraint.confdeltype codes
+// to ON DELETE actions
+var onDeleteActions = map[string]string{
+	"cascade":   "CASCADE",
+	"restrict":  "RESTRICT",
+	"set null":  "SET NULL",
+	"set_null":  "SET NULL",
+	"no action": "NO ACTION",
+	"no_action": "NO ACTION",
+	"c":         "CASCADE",
+	"r":         "RESTRICT",
+	"n":         "SET NULL",
+	"a":         "NO ACTION",
+	"d":         "SET DEFAULT",
+}
+
+// DiscoverRelations returns the relations declared on the models
+func DiscoverRelations(models ...interface{}) ([]Relation, error) {
+	var relations []Relation
+	for _, model := range models {
+		meta, err := GetModelMeta(model)
+		if err != nil {
+			return nil, err
+		}
+		relations = append(relations, meta.Relations...)
+	}
+	return relations, nil
+}
+
+// parseRelationTag builds the relation declared on a field
+func parseRelationTag(model reflect.Type, field reflect.StructField, tag string) (Relation, error) {
+	parts := strings.Split(tag, ",")
+	relation := Relation{
+		Kind:  RelationKind(strings.TrimSpace(parts[0])),
+		Field: field.Name,
+		Table: tableName(model),
+		model: model,
+	}
+
+	refType := field.Type
+	switch relation.Kind {
+	case ManyToMany, HasMany:
+		if refType.Kind() != reflect.Slice {
+			return relation, fmt.Errorf("field %s: %s relation needs a slice", field.Name, relation.Kind)
+		}
+		refType = refType.Elem()
+	case BelongsTo:
+	default:
+		return relation, fmt.Errorf("field %s: unknown relation %q", field.Name, relation.Kind)
+	}
+	if refType.Kind() == reflect.Ptr {
+		refType = refType.Elem()
+	}
+	if refType.Kind() != reflect.Struct {
+		return relation, fmt.Errorf("field %s: related type must be a struct", field.Name)
+	}
+	relation.RefTable = tableName(refType)
+	relation.refModel = refType
+
+	for _, part := range parts[1:] {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return relation, fmt.Errorf("field %s: rel tag option %q needs a value", field.Name, part)
+		}
+
+		switch strings.TrimSpace(key) {
+		case "join":
+			relation.JoinTable = value
+		case "fk":
+			relation.ForeignKey = value
+		case "ref_fk":
+			relation.RefKey = value
+		case "on_delete":
+			relation.OnDelete = onDeleteActions[strings.ToLower(value)]
+			if relation.OnDelete == "" {
+				return relation, fmt.Errorf("field %s: unknown on_delete action %q", field.Name, value)
+			}
+		default:
+			return relation, fmt.Errorf("field %s: unknown rel tag option %q", field.Name, key)
+		}
+	}
+
+	if relation.OnDelete == "" {
+		relation.OnDelete = "NO ACTION"
+	}
+
+	payload, hasPayload := field.Tag.Lookup("payload")
+	if hasPayload && relation.Kind != ManyToMany {
+		return relation, fmt.Errorf("field %s: only many2many relations have a payload", field.Name)
+	}
+	for _, spec := range splitTagOptions(payload, ';') {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		column, err := parseColumnSpec(field.Name, strings.TrimSpace(spec))
+		if err != nil {
+			return relation, err
+		}
+		if column.Name == "" || column.Type == "" || column.Skip || column.PrimaryKey {
+			return relation, fmt.Errorf("field %s: payload column %q needs a name and a type", field.Name, spec)
+		}
+		relation.payload = append(relation.payload, column)
+	}
+
+	switch relation.Kind {
+	case ManyToMany:
+		if relation.OnDelete == "SET NULL" {
+			return relation, fmt.Errorf("field %s: join table keys cannot be set to null", field.Name)
+		}
+		if relation.JoinTable == "" {
+			relation.JoinTable = relation.Table + "_" + relation.RefTable
+		}
+		if relation.ForeignKey == "" {
+			relation.ForeignKey = relation.Table + "_id"
+		}
+		if relation.RefKey == "" {
+			relation.RefKey = relation.RefTable + "_id"
+		}
+		if relation.ForeignKey == relation.RefKey {
+			return relation, fmt.Errorf("field %s: fk and ref_fk must differ", field.Name)
+		}
+	case HasMany:
+		if relation.ForeignKey == "" {
+			relation.ForeignKey = relation.Table + "_id"
+		}
+	case BelongsTo:
+		if relation.ForeignKey == "" {
+			relation.ForeignKey = relation.RefTable + "_id"
+		}
+	}
+
+	return relation, nil
+}
+
+// foreignKey is one foreign key constraint created for a relation
+type foreignKey struct {
+	Table  string
+	Column string
+	// Type is the type of Column, that of the referenced primary key
+	Type      string
+	RefTable  string
+	RefColumn string
+	OnDelete  string
+}
+
+// Name follows the Postgres <table>_<column>_fkey naming
+func (fk foreignKey) Name() string {
+	return fmt.Sprintf("%s_%s_fkey", fk.Table, fk.Column)
+}
+
+// CreateJoinTables creates the join tables of the many2many relations, or
+// brings existing ones in line with their foreign keys, indexes and payload
+func CreateJoinTables(db *sql.DB, relations []Relation) error {
+	for _, relation := range relations {
+		if relation.Kind != ManyToMany {
+			continue
+		}
+
+		changes, err := planRelation(db, relation)
+		if err != nil {
+			return err
+		}
+		err = ApplySchemaChanges(db, changes)
+		if err != nil {
+			return fmt.Errorf("error creating join table %s: %v", relation.JoinTable, err)
+		}
+	}
+	return nil
+}
+
+// CreateForeignKeys adds the foreign key columns, constraints and indexes
+// of the has_many and belongs_to relations
+func CreateForeignKeys(db *sql.DB, relations []Relation) error {
+	for _, relation := range relations {
+		if relation.Kind == ManyToMany {
+			continue
+		}
+
+		changes, err := planRelation(db, relation)
+		if err != nil {
+			return err
+		}
+		err = ApplySchemaChanges(db, changes)
+		if err != nil {
+			return fmt.Errorf("error creating foreign key %s.%s: %v", relation.Table, relation.ForeignKey, err)
+		}
+	}
+	return nil
+}
+
+// PlanRelations returns the changes needed by the join tables, foreign keys
+// and foreign key indexes of the relations
+func PlanRelations(db *sql.DB, relations []Relation) ([]SchemaChange, error) {
+	var changes []SchemaChange
+	for _, relation := range relations {
+		relationChanges, err := planRelation(db, relation)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, relationChanges...)
+	}
+	return changes, nil
+}
+
+// planRelation compares one relation with the database
+func planRelation(db *sql.DB, relation Relation) ([]SchemaChange, error) {
+	var changes []SchemaChange
+
+	if relation.Kind == ManyToMany {
+		existingColumns, err := getExistingColumns(db, relation.JoinTable)
+		if err != nil {
+			return nil, err
+		}
+		if len(existingColumns) == 0 {
+			queries, err := joinTableQueries(relation)
+			if err != nil {
+				return nil, err
+			}
+			return []SchemaChange{{
+				Table:  relation.JoinTable,
+				Kind:   ChangeCreateTable,
+				Detail: fmt.Sprintf("%s <-> %s", relation.Table, relation.RefTable),
+				SQL:    queries,
+			}}, nil
+		}
+		joinColumns, err := joinTableColumns(relation)
+		if err != nil {
+			return nil, err
+		}
+		changes = diffColumns(relation.JoinTable, joinColumns, existingColumns)
+	}
+
+	foreignKeys, err := relationForeignKeys(relation)
+	if err != nil {
+		return nil, err
+	}
+	for _, fk := range foreignKeys {
+		var deleteCode string
+		query, args := sqlb.Select("confdeltype").From("pg_constraint").Where(sqlb.Eq("conname", fk.Name())).Build()
+		err := db.QueryRow(query, args...).Scan(&deleteCode)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("error checking foreign key %s: %v", fk.Name(), err)
+		}
+
+		if err == sql.ErrNoRows {
+			queries := []string{}
+			if relation.Kind != ManyToMany {
+				// the model may have no field for the foreign key column
+				queries = append(queries, sqlb.AlterTable(fk.Table, "ADD COLUMN IF NOT EXISTS "+sqlb.ColumnDef(fk.Column, fk.Type)))
+			}
+			changes = append(changes, SchemaChange{
+				Table:  fk.Table,
+				Column: fk.Column,
+				Kind:   ChangeForeignKey,
+				Detail: fmt.Sprintf("add references %s ON DELETE %s", fk.RefTable, fk.OnDelete),
+				SQL:    append(queries, foreignKeyQuery(fk)),
+			})
+		} else if onDeleteActions[deleteCode] != fk.OnDelete {
+			changes = append(changes, SchemaChange{
+				Table:  fk.Table,
+				Column: fk.Column,
+				Kind:   ChangeForeignKey,
+				Detail: fmt.Sprintf("ON DELETE %s -> %s", onDeleteActions[deleteCode], fk.OnDelete),
+				SQL:    []string{foreignKeyQuery(fk)},
+			})
+		}
+	}
+
+	for _, column := range relationIndexColumns(relation) {
+		table := relation.JoinTable
+		if relation.Kind != ManyToMany {
+			table = foreignKeys[0].Table
+		}
+
+		var exists bool
+		indexName := fmt.Sprintf("%s_%s_idx", table, column)
+		query, args := sqlb.Select().ColumnExpr("EXISTS (SELECT 1 FROM pg_indexes WHERE schemaname = current_schema() AND indexname = ?)", indexName).Build()
+		err := db.QueryRow(query, args...).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("error checking index %s: %v", indexName, err)
+		}
+		if !exists {
+			changes = append(changes, SchemaChange{
+				Table:  table,
+				Column: column,
+				Kind:   ChangeIndex,
+				SQL:    []string{indexQuery(table, column)},
+			})
+		}
+	}
+
+	return changes, nil
+}
+
+// relationForeignKeys returns the foreign keys of a relation: both keys of
+// a join table, or the single key of a has_many or belongs_to relation.
+// They reference the primary keys of the models.
+func relationForeignKeys(relation Relation) ([]foreignKey, error) {
+	key, err := referencedKey(relation.model)
+	if err != nil {
+		return nil, err
+	}
+	refKey, err := referencedKey(relation.refModel)
+	if err != nil {
+		return nil, err
+	}
+
+	switch relation.Kind {
+	case ManyToMany:
+		return []foreignKey{
+			{Table: relation.JoinTable, Column: relation.ForeignKey, Type: referenceType(key), RefTable: relation.Table, RefColumn: key.Name, OnDelete: relation.OnDelete},
+			{Table: relation.JoinTable, Column: relation.RefKey, Type: referenceType(refKey), RefTable: relation.RefTable, RefColumn: refKey.Name, OnDelete: relation.OnDelete},
+		}, nil
+	case BelongsTo:
+		return []foreignKey{{Table: relation.Table, Column: relation.ForeignKey, Type: referenceType(refKey), RefTable: relation.RefTable, RefColumn: refKey.Name, OnDelete: relation.OnDelete}}, nil
+	default:
+		return []foreignKey{{Table: relation.RefTable, Column: relation.ForeignKey, Type: referenceType(key), RefTable: relation.Table, RefColumn: key.Name, OnDelete: relation.OnDelete}}, nil
+	}
+}
+
+// referencedKey returns the primary key of a model of a relation
+func referencedKey(model reflect.Type) (Column, error) {
+	meta, err := GetModelMeta(model)
+	if err != nil {
+		return Column{}, err
+	}
+	return meta.PrimaryKey, nil
+}
+
+// referenceType returns the type of a column referencing a primary key: the
+// key type, or the integer type behind a serial one
+func referenceType(key Column) string {
+	for integerType, serialType := range serialTypes {
+		if strings.EqualFold(key.Type, serialType) {
+			return integerType
+		}
+	}
+	return key.Type
+}
+
+// relationIndexColumns returns the foreign key columns needing a secondary
+// index. The first join table key already leads the primary key index.
+func relationIndexColumns(relation Relation) []string {
+	if relation.Kind == ManyToMany {
+		return []string{relation.RefKey}
+	}
+	return []string{relation.ForeignKey}
+}
+
+// joinTableColumns returns both keys of a join table followed by its payload
+func joinTableColumns(relation Relation) ([]Column, error) {
+	foreignKeys, err := relationForeignKeys(relation)
+	if err != nil {
+		return nil, err
+	}
+	var columns []Column
+	for _, fk := range foreignKeys {
+		columns = append(columns, Column{Name: fk.Column, Type: fk.Type, NotNull: true})
+	}
+	return append(columns, relation.payload...), nil
+}
+
+// joinTableQueries returns the CREATE TABLE statement of a many2many
+// relation followed by its index statements
+func joinTableQueries(relation Relation) ([]string, error) {
+	columns, err := joinTableColumns(relation)
+	if err != nil {
+		return nil, err
+	}
+	foreignKeys, err := relationForeignKeys(relation)
+	if err != nil {
+		return nil, err
+	}
+
+	var definitions []string
+	for _, column := range columns {
+		definitions = append(definitions, columnDefinition(column))
+	}
+	definitions = append(definitions, "PRIMARY KEY ("+sqlb.Idents(relation.ForeignKey, relation.RefKey)+")")
+	for _, fk := range foreignKeys {
+		definitions = append(definitions, foreignKeyDefinition(fk))
+	}
+
+	queries := []string{sqlb.CreateTable(relation.JoinTable, definitions...)}
+	for _, column := range relationIndexColumns(relation) {
+		queries = append(queries, indexQuery(relation.JoinTable, column))
+	}
+	return queries, nil
+}
+
+// foreignKeyDefinition renders the constraint of a foreign key
+func foreignKeyDefinition(fk foreignKey) string {
+	return fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s(%s) ON DELETE %s",
+		sqlb.Ident(fk.Name()), sqlb.Ident(fk.Column), sqlb.Ident(fk.RefTable), sqlb.Ident(fk.RefColumn), fk.OnDelete)
+}
+
+// foreignKeyQuery (re)creates a foreign key constraint. Dropping first keeps
+// it idempotent, as ADD CONSTRAINT has no IF NOT EXISTS.
+func foreignKeyQuery(fk foreignKey) string {
+	return sqlb.AlterTable(fk.Table, "DROP CONSTRAINT IF EXISTS "+sqlb.Ident(fk.Name()), "ADD "+foreignKeyDefinition(fk))
+}
@@ -0,0 +1,94 @@
+package helper
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// models whose primary keys are not a serial id
+type fkAuthor struct {
+	Code  string   `db:"code,pk,type=uuid"`
+	Books []fkBook `rel:"has_many,fk=author_code"`
+}
+
+type fkBook struct {
+	ID     int64     `db:"id,pk"`
+	Labels []fkLabel `rel:"many2many,on_delete=cascade"`
+	Author *fkAuthor `rel:"belongs_to,fk=author_code"`
+}
+
+type fkLabel struct {
+	Name string `db:"name,pk"`
+}
+
+func TestRelationForeignKeys(t *testing.T) {
+	tests := []struct {
+		model interface{}
+		field string
+		want  []foreignKey
+	}{
+		{
+			model: fkAuthor{},
+			field: "Books",
+			want:  []foreignKey{{Table: "fkbook", Column: "author_code", Type: "uuid", RefTable: "fkauthor", RefColumn: "code", OnDelete: "NO ACTION"}},
+		},
+		{
+			model: fkBook{},
+			field: "Author",
+			want:  []foreignKey{{Table: "fkbook", Column: "author_code", Type: "uuid", RefTable: "fkauthor", RefColumn: "code", OnDelete: "NO ACTION"}},
+		},
+		{
+			model: fkBook{},
+			field: "Labels",
+			want: []foreignKey{
+				{Table: "fkbook_fklabel", Column: "fkbook_id", Type: "BIGINT", RefTable: "fkbook", RefColumn: "id", OnDelete: "CASCADE"},
+				{Table: "fkbook_fklabel", Column: "fklabel_id", Type: "TEXT", RefTable: "fklabel", RefColumn: "name", OnDelete: "CASCADE"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			meta, err := GetModelMeta(tt.model)
+			if err != nil {
+				t.Fatal(err)
+			}
+			relation, ok := meta.Relation(tt.field)
+			if !ok {
+				t.Fatalf("no relation %s", tt.field)
+			}
+			got, err := relationForeignKeys(relation)
+			if err != nil {
+				t.Fatalf("relationForeignKeys() error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("relationForeignKeys() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinTableQueries(t *testing.T) {
+	meta, err := GetModelMeta(fkBook{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	relation, _ := meta.Relation("Labels")
+	queries, err := joinTableQueries(relation)
+	if err != nil {
+		t.Fatalf("joinTableQueries() error: %v", err)
+	}
+
+	create := queries[0]
+	for _, want := range []string{
+		`"fkbook_id" BIGINT NOT NULL`,
+		`"fklabel_id" TEXT NOT NULL`,
+		`FOREIGN KEY ("fkbook_id") REFERENCES "fkbook"("id") ON DELETE CASCADE`,
+		`FOREIGN KEY ("fklabel_id") REFERENCES "fklabel"("name") ON DELETE CASCADE`,
+	} {
+		if !strings.Contains(create, want) {
+			t.Errorf("join table %s\nlacks %s", create, want)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package helper
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"api-go/sqlb"
+)
+
+// Querier is satisfied by *sql.DB and *sql.Tx
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Query filters and orders the rows returned by Repository.List
+type Query struct {
+	// Where matches columns by equality, a slice value matches any element
+	Where map[string]interface{}
+	// Conds are further conditions, all of them have to match
+	Conds []sqlb.Cond
+	// OrderBy lists columns, a leading "-" sorts descending
+	OrderBy []string
+	Limit   int
+	Offset  int
+}
+
+// Repository gives typed access to the table of a model, using the
+// metadata of the registry
+type Repository[T any] struct {
+	db   Querier
+	meta *ModelMeta
+}
+
+// NewRepository returns the repository of the model T
+func NewRepository[T any](db Querier) (*Repository[T], error) {
+	var model T
+	meta, err := GetModelMeta(reflect.TypeOf(model))
+	if err != nil {
+		return nil, err
+	}
+	return &Repository[T]{db: db, meta: meta}, nil
+}
+
+// Meta returns the metadata of the model
+func (r *Repository[T]) Meta() *ModelMeta {
+	return r.meta
+}
+
+// Insert inserts a model and reads back every column, including the
+// generated primary key. It writes the given columns, the others taking
+// their database default, or every column when none is given. A serial
+// primary key is generated unless it is one of the given columns, so ids of
+// request bodies are never inserted.
+func (r *Repository[T]) Insert(model *T, columns ...string) error {
+	v := reflect.ValueOf(model).Elem()
+
+	if len(columns) == 0 {
+		for _, column := range r.meta.Columns {
+			if !(column.PrimaryKey && isSerialType(column.Type)) {
+				columns = append(columns, column.Name)
+			}
+		}
+	}
+
+	var names []string
+	var values []interface{}
+	for _, name := range columns {
+		column, ok := r.column(name)
+		if !ok {
+			return fmt.Errorf("cannot insert column %q of %s", name, r.meta.Table)
+		}
+		names = append(names, column.Name)
+		values = append(values, fieldValue(column, v.FieldByIndex(column.FieldIndex)))
+	}
+
+	query, args := sqlb.Insert(r.meta.Table).Columns(names...).Values(values...).
+		Returning(r.meta.ColumnNames()...).
+		Build()
+	err := r.db.QueryRow(query, args...).Scan(r.meta.ScanDest(model)...)
+	if err != nil {
+		return fmt.Errorf("error inserting into %s: %w", r.meta.Table, err)
+	}
+	return nil
+}
+
+// FindByID returns the model with the given primary key, or sql.ErrNoRows
+func (r *Repository[T]) FindByID(id interface{}) (*T, error) {
+	query, args := sqlb.Select(r.meta.ColumnNames()...).From(r.meta.Table).
+		Where(sqlb.Eq(r.meta.PrimaryKey.Name, id)).
+		Build()
+
+	model := new(T)
+	err := r.db.QueryRow(query, args...).Scan(r.meta.ScanDest(model)...)
+	if err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// Update writes the given columns of a model, or every column when none is
+// given, and reads the whole row back. It returns sql.ErrNoRows when no row
+// has the model primary key.
+func (r *Repository[T]) Update(model *T, columns ...string) error {
+	v := reflect.ValueOf(model).Elem()
+
+	if len(columns) == 0 {
+		for _, column := range r.meta.Columns {
+			if !column.PrimaryKey {
+				columns = append(columns, column.Name)
+			}
+		}
+	}
+
+	update := sqlb.Update(r.meta.Table)
+	for _, name := range columns {
+		column, ok := r.column(name)
+		if !ok || column.PrimaryKey {
+			return fmt.Errorf("cannot update column %q of %s", name, r.meta.Table)
+		}
+		update.Set(column.Name, fieldValue(column, v.FieldByIndex(column.FieldIndex)))
+	}
+
+	query, args := update.
+		Where(sqlb.Eq(r.meta.PrimaryKey.Name, v.FieldByIndex(r.meta.PrimaryKey.FieldIndex).Interface())).
+		Returning(r.meta.ColumnNames()...).
+		Build()
+	return r.db.QueryRow(query, args...).Scan(r.meta.ScanDest(model)...)
+}
+
+// Delete deletes the model with the given primary key and tells whether a
+// row was deleted
+func (r *Repository[T]) Delete(id interface{}) (bool, error) {
+	query, args := sqlb.Delete(r.meta.Table).Where(sqlb.Eq(r.meta.PrimaryKey.Name, id)).Build()
+
+	result, err := r.db.Exec(query, args...)
+	if err != nil {
+		return false, fmt.Errorf("error deleting from %s: %w", r.meta.Table, err)
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// List returns the models matching the query
+func (r *Repository[T]) List(q Query) ([]T, error) {
+	sel := sqlb.Select(r.meta.ColumnNames()...).From(r.meta.Table)
+	if err := r.where(sel, q); err != nil {
+		return nil, err
+	}
+
+	for _, order := range q.OrderBy {
+		desc := strings.HasPrefix(order, "-")
+		column, ok := r.column(strings.TrimPrefix(order, "-"))
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q of %s", order, r.meta.Table)
+		}
+		sel.OrderBy(column.Name, desc)
+	}
+
+	query, args := sel.Limit(q.Limit).Offset(q.Offset).Build()
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s: %w", r.meta.Table, err)
+	}
+	defer rows.Close()
+
+	models := []T{}
+	for rows.Next() {
+		var model T
+		if err := rows.Scan(r.meta.ScanDest(&model)...); err != nil {
+			return nil, fmt.Errorf("error scanning %s: %w", r.meta.Table, err)
+		}
+		models = append(models, model)
+	}
+	return models, rows.Err()
+}
+
+// Count returns the number of models matching the conditions of the query,
+// ignoring its order, limit and offset
+func (r *Repository[T]) Count(q Query) (int, error) {
+	sel := sqlb.Select().ColumnExpr("COUNT(*)").From(r.meta.Table)
+	if err := r.where(sel, q); err != nil {
+		return 0, err
+	}
+
+	var count int
+	query, args := sel.Build()
+	if err := r.db.QueryRow(query, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error counting %s: %w", r.meta.Table, err)
+	}
+	return count, nil
+}
+
+// SortValues reads the stored values of the sorted columns of a model row,
+// NULLs included, to make the cursor of the row
+func (r *Repository[T]) SortValues(sort Sort, model *T) ([]interface{}, error) {
+	id := reflect.ValueOf(model).Elem().FieldByIndex(r.meta.PrimaryKey.FieldIndex).Interface()
+	query, args := sqlb.Select(sort.Columns()...).From(r.meta.Table).
+		Where(sqlb.Eq(r.meta.PrimaryKey.Name, id)).
+		Build()
+
+	values := make([]interface{}, len(sort))
+	dest := make([]interface{}, len(sort))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := r.db.QueryRow(query, args...).Scan(dest...); err != nil {
+		return nil, fmt.Errorf("error reading the sort values of %s: %w", r.meta.Table, err)
+	}
+	for i, value := range values {
+		if b, ok := value.([]byte); ok {
+			values[i] = string(b)
+		}
+	}
+	return values, nil
+}
+
+// where adds the conditions of a query to a select
+func (r *Repository[T]) where(sel *sqlb.SelectBuilder, q Query) error {
+	// sort the filters so the same query always gives the same SQL
+	var filterColumns []string
+	for name := range q.Where {
+		filterColumns = append(filterColumns, name)
+	}
+	sort.Strings(filterColumns)
+
+	for _, name := range filterColumns {
+		column, ok := r.column(name)
+		if !ok {
+			return fmt.Errorf("unknown column %q of %s", name, r.meta.Table)
+		}
+
+		value := q.Where[name]
+		if rv := reflect.ValueOf(value); rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+			sel.Where(sqlb.In(column.Name, value))
+		} else {
+			sel.Where(sqlb.Eq(column.Name, value))
+		}
+	}
+	sel.Where(q.Conds...)
+	return nil
+}
+
+// Load fills the relation field of one model
+func (r *Repository[T]) Load(model *T, field string) error {
+	models := []T{*model}
+	err := r.LoadRelation(models, field)
+	*model = models[0]
+	return err
+}
+
+// LoadRelation fills the relation field of every model with a single query.
+// Many2many rows come in join table position order when the join rows have
+// a position payload column.
+func (r *Repository[T]) LoadRelation(models []T, field string) error {
+	relation, ok := r.meta.Relation(field)
+	if !ok {
+		return fmt.Errorf("%s has no relation %q", r.meta.Table, field)
+	}
+	if len(models) == 0 {
+		return nil
+	}
+
+	list := reflect.ValueOf(models)
+	structField, _ := r.meta.Type.FieldByName(field)
+	refType := structField.Type
+	if refType.Kind() == reflect.Slice {
+		refType = refType.Elem()
+	}
+	isPtr := refType.Kind() == reflect.Ptr
+	if isPtr {
+		refType = refType.Elem()
+	}
+	refMeta, err := GetModelMeta(refType)
+	if err != nil {
+		return err
+	}
+
+	// the key read from each model to match the related rows
+	keyIndex := r.meta.PrimaryKey.FieldIndex
+	if relation.Kind == BelongsTo {
+		column, ok := r.column(relation.ForeignKey)
+		if !ok {
+			return fmt.Errorf("%s has no field for column %s", r.meta.Table, relation.ForeignKey)
+		}
+		keyIndex = column.FieldIndex
+	}
+
+	var keys []interface{}
+	for i := 0; i < list.Len(); i++ {
+		keys = append(keys, list.Index(i).FieldByIndex(keyIndex).Interface())
+	}
+
+	refColumns := make([]string, len(refMeta.Columns))
+	for i, name := range refMeta.ColumnNames() {
+		refColumns[i] = "r." + name
+	}
+
+	var sel *sqlb.SelectBuilder
+	switch relation.Kind {
+	case ManyToMany:
+		sel = sqlb.Select("j."+relation.ForeignKey).Columns(refColumns...).
+			From(refMeta.Table, "r").
+			Join(relation.JoinTable, "j", sqlb.Expr(sqlb.Ident("j."+relation.RefKey)+" = "+sqlb.Ident("r."+refMeta.PrimaryKey.Name))).
+			Where(sqlb.In("j."+relation.ForeignKey, keys))
+		for _, column := range relation.payload {
+			if column.Name == "position" {
+				sel.OrderBy("j.position", false)
+			}
+		}
+		sel.OrderBy("r."+refMeta.PrimaryKey.Name, false)
+	case HasMany:
+		sel = sqlb.Select("r."+relation.ForeignKey).Columns(refColumns...).
+			From(refMeta.Table, "r").
+			Where(sqlb.In("r."+relation.ForeignKey, keys)).
+			OrderBy("r."+refMeta.PrimaryKey.Name, false)
+	case BelongsTo:
+		sel = sqlb.Select("r."+refMeta.PrimaryKey.Name).Columns(refColumns...).
+			From(refMeta.Table, "r").
+			Where(sqlb.In("r."+refMeta.PrimaryKey.Name, keys))
+	}
+
+	query, args := sel.Build()
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("error loading %s of %s: %w", field, r.meta.Table, err)
+	}
+	defer rows.Close()
+
+	// related rows grouped by the key they belong to
+	related := make(map[interface{}][]reflect.Value)
+	for rows.Next() {
+		var key interface{}
+		ref := reflect.New(refType)
+		dest := append([]interface{}{&key}, refMeta.ScanDest(ref.Interface())...)
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("error scanning %s of %s: %w", field, r.meta.Table, err)
+		}
+		if !isPtr {
+			ref = ref.Elem()
+		}
+		if b, ok := key.([]byte); ok {
+			key = string(b)
+		}
+		related[key] = append(related[key], ref)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := 0; i < list.Len(); i++ {
+		target := list.Index(i).FieldByName(field)
+		matches := related[normalizeKey(keys[i])]
+		if relation.Kind == BelongsTo {
+			if len(matches) > 0 {
+				target.Set(matches[0])
+			}
+			continue
+		}
+
+		values := reflect.MakeSlice(target.Type(), 0, len(matches))
+		values = reflect.Append(values, matches...)
+		target.Set(values)
+	}
+	return nil
+}
+
+// column returns the column with the given name
+func (r *Repository[T]) column(name string) (Column, bool) {
+	for _, column := range r.meta.Columns {
+		if column.Name == name {
+			return column, true
+		}
+	}
+	return Column{}, false
+}
+
+// normalizeKey converts Go integer keys to the int64 the driver scans, so
+// model keys and scanned keys can be compared
+func normalizeKey(key interface{}) interface{} {
+	v := reflect.ValueOf(key)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint())
+	}
+	return key
+}
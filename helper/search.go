@@ -0,0 +1,162 @@
+package helper
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"api-go/sqlb"
+)
+
+// SearchColumn is the generated tsvector column of searchable models
+const SearchColumn = "search_vector"
+
+// defaultSearchConfig is the text search configuration of models not
+// implementing TextSearcher
+const defaultSearchConfig = "simple"
+
+// TextSearcher is implemented by models choosing the text search
+// configuration of their search column, such as english
+type TextSearcher interface {
+	SearchConfig() string
+}
+
+// SearchIndex is the full text search column of a model. It is a stored
+// tsvector generated from the columns with a search weight, indexed with
+// GIN, so searches never parse the documents again.
+type SearchIndex struct {
+	Column  string
+	Config  string
+	Columns []Column
+}
+
+// TextSearch is a full text search of a model
+type TextSearch struct {
+	// Query is written in the web search syntax: words, "quoted phrases",
+	// or and -excluded words
+	Query string
+	// Headline is the column the highlighted snippet is taken from
+	Headline string
+}
+
+// SearchHit is a model found by a search with its rank and snippet. The
+// snippet is HTML escaped, with the matches wrapped in <mark>.
+type SearchHit[T any] struct {
+	Model    T
+	Rank     float64
+	Headline string
+}
+
+// headlineOptions highlights matches with <mark> in at most two fragments
+const headlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2"
+
+// htmlEscapes are the replacements escapeHTML applies, & first so the
+// entities it adds are kept
+var htmlEscapes = [][2]string{{"&", "&amp;"}, {"<", "&lt;"}, {">", "&gt;"}, {`"`, "&#34;"}, {"'", "&#39;"}}
+
+// escapeHTML wraps a text expression so its value is HTML escaped. Headlines
+// escape the content before marking the matches, so only <mark> is markup.
+func escapeHTML(expr string) string {
+	for _, escape := range htmlEscapes {
+		expr = fmt.Sprintf("replace(%s, %s, %s)", expr, pq.QuoteLiteral(escape[0]), pq.QuoteLiteral(escape[1]))
+	}
+	return expr
+}
+
+// readSearchIndex returns the search column of a model, nil when none of
+// its columns has a search weight
+func readSearchIndex(meta *ModelMeta) *SearchIndex {
+	index := &SearchIndex{Column: SearchColumn, Config: defaultSearchConfig}
+	for _, column := range meta.Columns {
+		if column.Search != "" {
+			index.Columns = append(index.Columns, column)
+		}
+	}
+	if len(index.Columns) == 0 {
+		return nil
+	}
+
+	if searcher, ok := reflect.New(meta.Type).Interface().(TextSearcher); ok {
+		index.Config = searcher.SearchConfig()
+	}
+	return index
+}
+
+// column returns the generated search column with its GIN index
+func (index *SearchIndex) column() Column {
+	config := pq.QuoteLiteral(index.Config) + "::regconfig"
+
+	var parts []string
+	for _, column := range index.Columns {
+		document := fmt.Sprintf("to_tsvector(%s, coalesce(%s::text, ''))", config, sqlb.Ident(column.Name))
+		parts = append(parts, fmt.Sprintf("setweight(%s, %s)", document, pq.QuoteLiteral(column.Search)))
+	}
+	return Column{
+		Name:        index.Column,
+		Type:        "TSVECTOR",
+		Index:       true,
+		Generated:   strings.Join(parts, " || "),
+		IndexMethod: "GIN",
+	}
+}
+
+// Match returns the condition matching the models found by a search, to
+// use in a Query
+func (r *Repository[T]) Match(search TextSearch) (sqlb.Cond, error) {
+	if r.meta.Search == nil {
+		return sqlb.Cond{}, fmt.Errorf("%s has no search column", r.meta.Table)
+	}
+	return sqlb.Expr(sqlb.Ident(r.meta.Search.Column)+" @@ ?", r.tsquery(search)), nil
+}
+
+// Search returns the models found by a search and matching the query,
+// best ranked first, then in primary key order. The order of the query is
+// ignored.
+func (r *Repository[T]) Search(search TextSearch, q Query) ([]SearchHit[T], error) {
+	match, err := r.Match(search)
+	if err != nil {
+		return nil, err
+	}
+	headline, ok := r.column(search.Headline)
+	if !ok {
+		return nil, fmt.Errorf("unknown column %q of %s", search.Headline, r.meta.Table)
+	}
+
+	tsquery := r.tsquery(search)
+	sel := sqlb.Select(r.meta.ColumnNames()...).
+		ColumnExpr("ts_rank("+sqlb.Ident(r.meta.Search.Column)+", ?)", tsquery).
+		ColumnExpr("ts_headline(?::regconfig, "+escapeHTML("coalesce("+sqlb.Ident(headline.Name)+"::text, '')")+", ?, ?)", r.meta.Search.Config, tsquery, headlineOptions).
+		From(r.meta.Table)
+	q.Conds = append(append([]sqlb.Cond{}, q.Conds...), match)
+	if err := r.where(sel, q); err != nil {
+		return nil, err
+	}
+	// the rank follows the model columns
+	sel.OrderByExpr(fmt.Sprintf("%d DESC", len(r.meta.Columns)+1)).OrderBy(r.meta.PrimaryKey.Name, false)
+
+	query, args := sel.Limit(q.Limit).Offset(q.Offset).Build()
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error searching %s: %w", r.meta.Table, err)
+	}
+	defer rows.Close()
+
+	hits := []SearchHit[T]{}
+	for rows.Next() {
+		var hit SearchHit[T]
+		dest := append(r.meta.ScanDest(&hit.Model), &hit.Rank, &hit.Headline)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("error scanning %s: %w", r.meta.Table, err)
+		}
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
+
+// tsquery returns the tsquery of a search, parsed with the text search
+// configuration of the search column so its lexemes match the stored ones
+func (r *Repository[T]) tsquery(search TextSearch) sqlb.Cond {
+	return sqlb.Expr("websearch_to_tsquery(?::regconfig, ?)", r.meta.Search.Config, search.Query)
+}
@@ -0,0 +1,10 @@
+package helper
+
+import "testing"
+
+func TestEscapeHTML(t *testing.T) {
+	want := `replace(replace(replace(replace(replace("content", '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;'), '''', '&#39;')`
+	if got := escapeHTML(`"content"`); got != want {
+		t.Errorf("escapeHTML() = %s, want %s", got, want)
+	}
+}
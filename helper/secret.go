@@ -0,0 +1,226 @@
+package helper
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// redacted replaces secrets in printed values, logs and errors
+const redacted = "[REDACTED]"
+
+// Secret is a config value never printed as is
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return strconv.Quote(s.String())
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(s.String())), nil
+}
+
+// secrets holds the secret values loaded so far, to redact them from
+// messages
+var secrets = struct {
+	sync.RWMutex
+	values []string
+}{}
+
+// addSecret registers a value to be redacted
+func addSecret(value string) {
+	if value == "" {
+		return
+	}
+	secrets.Lock()
+	defer secrets.Unlock()
+	for _, known := range secrets.values {
+		if known == value {
+			return
+		}
+	}
+	secrets.values = append(secrets.values, value)
+}
+
+// Redact replaces every secret loaded from the config in s
+func Redact(s string) string {
+	secrets.RLock()
+	defer secrets.RUnlock()
+	for _, value := range secrets.values {
+		s = strings.ReplaceAll(s, value, redacted)
+	}
+	return s
+}
+
+// redactError returns err with the secrets removed from its message
+func redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	message := Redact(err.Error())
+	if message == err.Error() {
+		return err
+	}
+	return errors.New(message)
+}
+
+// resolvePassword sets the password from password_file or password_env, or
+// from a pgpass file when no password is configured, and registers every
+// secret of the database config for redaction
+func (database *DatabaseConfig) resolvePassword() error {
+	sources := 0
+	for _, set := range []bool{database.Password != "", database.PasswordFile != "", database.PasswordEnv != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return errors.New("only one of database.password, database.password_file and database.password_env can be set")
+	}
+
+	switch {
+	case database.PasswordFile != "":
+		content, err := os.ReadFile(database.PasswordFile)
+		if err != nil {
+			return errors.New("error reading database.password_file: " + err.Error())
+		}
+		database.Password = Secret(strings.TrimRight(string(content), "\r\n"))
+	case database.PasswordEnv != "":
+		value, ok := os.LookupEnv(database.PasswordEnv)
+		if !ok {
+			return fmt.Errorf("database.password_env: environment variable %s is not set", database.PasswordEnv)
+		}
+		database.Password = Secret(value)
+	case database.Password == "" && database.DSN == "":
+		password, err := lookupPgpass(*database)
+		if err != nil {
+			return err
+		}
+		database.Password = Secret(password)
+	}
+
+	addSecret(string(database.Password))
+	addSecret(string(database.DSN))
+	addSecret(dsnPassword(string(database.DSN)))
+	return nil
+}
+
+// dsnPassword returns the password of a URL or key=value connection string
+func dsnPassword(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		password, _ := u.User.Password()
+		return password
+	}
+
+	for _, param := range strings.Fields(dsn) {
+		if value := strings.TrimPrefix(param, "password="); value != param {
+			return strings.Trim(value, "'")
+		}
+	}
+	return ""
+}
+
+// pgpassPath returns the pgpass file to read: database.passfile, PGPASSFILE
+// or ~/.pgpass
+func pgpassPath(database DatabaseConfig) string {
+	if database.PassFile != "" {
+		return database.PassFile
+	}
+	if path := os.Getenv("PGPASSFILE"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".pgpass")
+}
+
+// lookupPgpass returns the password of the first hostname:port:database:
+// username:password line of the pgpass file matching the config, * matching
+// anything. Like libpq, a missing file gives no password and a file others
+// can read is ignored.
+func lookupPgpass(database DatabaseConfig) (string, error) {
+	path := pgpassPath(database)
+	if path == "" {
+		return "", nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && database.PassFile == "" {
+			return "", nil
+		}
+		return "", errors.New("error reading database.passfile: " + err.Error())
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		log.Printf("Ignoring password file %s, it has group or world access", path)
+		return "", nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", errors.New("error reading database.passfile: " + err.Error())
+	}
+	defer file.Close()
+
+	want := []string{database.Host, strconv.Itoa(database.Port), database.DBName, database.User}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		fields := splitPgpassLine(line)
+		if len(fields) != 5 {
+			continue
+		}
+		matches := true
+		for i, value := range want {
+			matches = matches && (fields[i] == "*" || fields[i] == value)
+		}
+		if matches {
+			return fields[4], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", errors.New("error reading database.passfile: " + err.Error())
+	}
+	return "", nil
+}
+
+// splitPgpassLine splits a pgpass line on colons, \: and \\ being escaped
+// colons and backslashes
+func splitPgpassLine(line string) []string {
+	var fields []string
+	var field strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line):
+			i++
+			field.WriteByte(line[i])
+		case line[i] == ':':
+			fields = append(fields, field.String())
+			field.Reset()
+		default:
+			field.WriteByte(line[i])
+		}
+	}
+	return append(fields, field.String())
+}
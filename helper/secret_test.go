@@ -0,0 +1,65 @@
+package helper
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitPgpassLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"db:5432:app:api:secret", []string{"db", "5432", "app", "api", "secret"}},
+		{"*:*:*:*:secret", []string{"*", "*", "*", "*", "secret"}},
+		{`db:5432:app:api:pa\:ss`, []string{"db", "5432", "app", "api", "pa:ss"}},
+		{`db:5432:app:api:back\\slash`, []string{"db", "5432", "app", "api", `back\slash`}},
+		{`db:5432:app:api:ends with\`, []string{"db", "5432", "app", "api", `ends with\`}},
+		{"db:5432:app:api:", []string{"db", "5432", "app", "api", ""}},
+		{"db:5432:app:api:a:b", []string{"db", "5432", "app", "api", "a", "b"}},
+		{"", []string{""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			if got := splitPgpassLine(tt.line); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitPgpassLine(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookupPgpass(t *testing.T) {
+	lines := "# comment\n" +
+		"other:5432:app:api:wrong-host\n" +
+		"db:5432:app:api:a\\:b\n" +
+		"*:*:*:*:fallback\n"
+
+	tests := []struct {
+		name     string
+		database DatabaseConfig
+		want     string
+	}{
+		{"exact match", DatabaseConfig{Host: "db", Port: 5432, DBName: "app", User: "api"}, "a:b"},
+		{"wildcard line", DatabaseConfig{Host: "db", Port: 5433, DBName: "app", User: "api"}, "fallback"},
+	}
+
+	path := filepath.Join(t.TempDir(), "pgpass")
+	if err := os.WriteFile(path, []byte(lines), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.database.PassFile = path
+			got, err := lookupPgpass(tt.database)
+			if err != nil {
+				t.Fatalf("lookupPgpass() error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("lookupPgpass() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package helper
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+// NewServer builds the HTTP server of the config around handler
+func NewServer(config ServerConfig, handler http.Handler) *http.Server {
+	server := &http.Server{
+		Addr:              config.Addr,
+		Handler:           handler,
+		ReadTimeout:       config.ReadTimeout,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+		MaxHeaderBytes:    config.MaxHeaderBytes,
+	}
+
+	if config.TLSEnabled() {
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		// a non nil TLSNextProto turns off the automatic HTTP/2 support
+		if config.DisableHTTP2 {
+			server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		}
+	}
+	return server
+}
+
+// TLSEnabled tells whether the server is configured to serve TLS
+func (config ServerConfig) TLSEnabled() bool {
+	return config.TLSCert != "" && config.TLSKey != ""
+}
+
+// Serve listens on the server address, with TLS when configured, until the
+// server is closed
+func Serve(server *http.Server, config ServerConfig) error {
+	if config.TLSEnabled() {
+		return server.ListenAndServeTLS(config.TLSCert, config.TLSKey)
+	}
+	return server.ListenAndServe()
+}
@@ -0,0 +1,208 @@
+package helper
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"api-go/sqlb"
+)
+
+// SortField is one key of the order of a list
+type SortField struct {
+	// Name is the name the field is sorted by in requests
+	Name     string
+	Column   string
+	Desc     bool
+	Nullable bool
+	// Expr is the SQL of a computed field, such as an aggregate, sorted
+	// instead of the column
+	Expr string
+}
+
+// Sort is the order of a list, ending with the primary key so that no two
+// rows tie and keyset pagination is stable
+type Sort []SortField
+
+// ParseSort reads the sort query parameter of a list of the model: comma
+// separated names of sortable columns or computed fields, a leading "-"
+// sorts descending. defaultSort, in the same syntax, applies without the
+// parameter.
+func ParseSort(r *http.Request, meta *ModelMeta, defaultSort string, computed ...SortField) (Sort, error) {
+	value := r.URL.Query().Get("sort")
+	if value == "" {
+		value = defaultSort
+	}
+
+	var sort Sort
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		desc := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		if name == "" {
+			continue
+		}
+
+		field, ok := computedField(computed, name)
+		if column, isColumn := meta.SortColumn(name); isColumn {
+			field, ok = sortField(column), true
+		}
+		if !ok {
+			return nil, fmt.Errorf("cannot sort by %q, sortable fields are %s", name, strings.Join(sortKeys(meta, computed), ", "))
+		}
+		if seen[field.Column] {
+			return nil, fmt.Errorf("%q is sorted by twice", name)
+		}
+		seen[field.Column] = true
+		field.Desc = desc
+		sort = append(sort, field)
+	}
+
+	if !seen[meta.PrimaryKey.Name] {
+		sort = append(sort, sortField(meta.PrimaryKey))
+	}
+	return sort, nil
+}
+
+// sortField returns the sort field of a column
+func sortField(column Column) SortField {
+	return SortField{Name: column.SortKey(), Column: column.Name, Nullable: !column.NotNull && !column.PrimaryKey}
+}
+
+// computedField returns the computed field sorted by name
+func computedField(computed []SortField, name string) (SortField, bool) {
+	for _, field := range computed {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return SortField{}, false
+}
+
+// sortKeys returns the names of the sortable columns of a model followed by
+// those of the computed fields
+func sortKeys(meta *ModelMeta, computed []SortField) []string {
+	var keys []string
+	for _, column := range meta.Columns {
+		if column.Sortable {
+			keys = append(keys, column.SortKey())
+		}
+	}
+	for _, field := range computed {
+		keys = append(keys, field.Name)
+	}
+	return keys
+}
+
+// String returns the sort in the syntax of the sort parameter
+func (sort Sort) String() string {
+	names := make([]string, len(sort))
+	for i, field := range sort {
+		names[i] = field.Name
+		if field.Desc {
+			names[i] = "-" + field.Name
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// OrderBy returns the sort in the form of Query.OrderBy, which has no
+// computed fields
+func (sort Sort) OrderBy() []string {
+	columns := make([]string, len(sort))
+	for i, field := range sort {
+		columns[i] = field.Column
+		if field.Desc {
+			columns[i] = "-" + field.Column
+		}
+	}
+	return columns
+}
+
+// Apply adds the sort to the ORDER BY clause of a select
+func (sort Sort) Apply(sel *sqlb.SelectBuilder) {
+	for _, field := range sort {
+		if field.Desc {
+			sel.OrderByExpr(field.ref() + " DESC")
+		} else {
+			sel.OrderByExpr(field.ref())
+		}
+	}
+}
+
+// Columns returns the sorted columns
+func (sort Sort) Columns() []string {
+	columns := make([]string, len(sort))
+	for i, field := range sort {
+		columns[i] = field.Column
+	}
+	return columns
+}
+
+// Cursor returns the cursor of a row from the values of its sorted columns
+func (sort Sort) Cursor(values []interface{}) string {
+	return EncodeCursor(append([]interface{}{sort.String()}, values...)...)
+}
+
+// After returns the condition matching the rows coming after the row of a
+// cursor. Rows sort before rows with a greater value in the first column
+// they differ on, in the direction of that column. NULLs sort last in
+// ascending order and first in descending order, as in PostgreSQL.
+func (sort Sort) After(cursor []interface{}) (sqlb.Cond, error) {
+	if len(cursor) != len(sort)+1 || cursor[0] != sort.String() {
+		return sqlb.Cond{}, ErrInvalidCursor
+	}
+	values := cursor[1:]
+
+	var after []sqlb.Cond
+	for i, field := range sort {
+		conds := make([]sqlb.Cond, 0, i+1)
+		for j, previous := range sort[:i] {
+			conds = append(conds, previous.equal(values[j]))
+		}
+
+		greater, ok := field.greater(values[i])
+		if !ok {
+			continue
+		}
+		after = append(after, sqlb.And(append(conds, greater)...))
+	}
+	if len(after) == 0 {
+		return sqlb.Expr("false"), nil
+	}
+	return sqlb.Or(after...), nil
+}
+
+// ref returns the SQL of the sorted value
+func (field SortField) ref() string {
+	if field.Expr != "" {
+		return field.Expr
+	}
+	return sqlb.Ident(field.Column)
+}
+
+// equal matches the rows whose field equals value
+func (field SortField) equal(value interface{}) sqlb.Cond {
+	if value == nil {
+		return sqlb.Expr(field.ref() + " IS NULL")
+	}
+	return sqlb.Expr(field.ref()+" = ?", value)
+}
+
+// greater matches the rows whose field comes after value in the sort
+// direction, it returns false when none can
+func (field SortField) greater(value interface{}) (sqlb.Cond, bool) {
+	switch {
+	case value == nil && field.Desc:
+		return sqlb.Expr(field.ref() + " IS NOT NULL"), true
+	case value == nil:
+		return sqlb.Cond{}, false
+	case field.Desc:
+		return sqlb.Expr(field.ref()+" < ?", value), true
+	case field.Nullable:
+		return sqlb.Or(sqlb.Expr(field.ref()+" > ?", value), sqlb.Expr(field.ref()+" IS NULL")), true
+	default:
+		return sqlb.Expr(field.ref()+" > ?", value), true
+	}
+}
@@ -0,0 +1,178 @@
+package helper
+
+import (
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"api-go/sqlb"
+)
+
+// sortedArticle is a model with sortable columns of each kind
+type sortedArticle struct {
+	ID          int        `db:"id,pk,sort"`
+	Title       string     `db:"title,notnull,sort"`
+	PublishDate *time.Time `db:"publishdate,sort=publish_date"`
+	Body        string     `db:"body"`
+}
+
+var (
+	sortByID          = SortField{Name: "id", Column: "id"}
+	sortByTitle       = SortField{Name: "title", Column: "title"}
+	sortByPublishDate = SortField{Name: "publish_date", Column: "publishdate", Nullable: true}
+	sortByCount       = SortField{Name: "count", Column: "count", Expr: "(SELECT 1)"}
+)
+
+func TestParseSort(t *testing.T) {
+	meta, err := GetModelMeta(sortedArticle{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := func(field SortField) SortField {
+		field.Desc = true
+		return field
+	}
+
+	tests := []struct {
+		sort    string
+		want    Sort
+		wantErr bool
+	}{
+		{sort: "", want: Sort{sortByTitle, sortByID}},
+		{sort: "-publish_date,title", want: Sort{desc(sortByPublishDate), sortByTitle, sortByID}},
+		{sort: " title , -id ", want: Sort{sortByTitle, desc(sortByID)}},
+		{sort: "id", want: Sort{sortByID}},
+		{sort: "-count", want: Sort{desc(sortByCount), sortByID}},
+		{sort: "title,,", want: Sort{sortByTitle, sortByID}},
+		{sort: "body", wantErr: true},
+		{sort: "publishdate", wantErr: true},
+		{sort: "title,-title", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/?sort="+url.QueryEscape(tt.sort), nil)
+			got, err := ParseSort(r, meta, "title", sortByCount)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseSort(%q) = %v, want an error", tt.sort, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSort(%q) error: %v", tt.sort, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSort(%q) = %+v, want %+v", tt.sort, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortAfter(t *testing.T) {
+	desc := sortByPublishDate
+	desc.Desc = true
+
+	tests := []struct {
+		name  string
+		sort  Sort
+		value interface{}
+		want  string
+		args  []interface{}
+	}{
+		{
+			name:  "ascending",
+			sort:  Sort{sortByTitle, sortByID},
+			value: "Go",
+			want:  `("title" > $1) OR (("title" = $2) AND ("id" > $3))`,
+			args:  []interface{}{"Go", "Go", 3},
+		},
+		{
+			name:  "ascending nullable, NULLs come last",
+			sort:  Sort{sortByPublishDate, sortByID},
+			value: "2024-01-01",
+			want:  `(("publishdate" > $1) OR ("publishdate" IS NULL)) OR (("publishdate" = $2) AND ("id" > $3))`,
+			args:  []interface{}{"2024-01-01", "2024-01-01", 3},
+		},
+		{
+			name:  "ascending from a NULL",
+			sort:  Sort{sortByPublishDate, sortByID},
+			value: nil,
+			want:  `("publishdate" IS NULL) AND ("id" > $1)`,
+			args:  []interface{}{3},
+		},
+		{
+			name:  "descending nullable, NULLs come first",
+			sort:  Sort{desc, sortByID},
+			value: "2024-01-01",
+			want:  `("publishdate" < $1) OR (("publishdate" = $2) AND ("id" > $3))`,
+			args:  []interface{}{"2024-01-01", "2024-01-01", 3},
+		},
+		{
+			name:  "descending from a NULL",
+			sort:  Sort{desc, sortByID},
+			value: nil,
+			want:  `("publishdate" IS NOT NULL) OR (("publishdate" IS NULL) AND ("id" > $1))`,
+			args:  []interface{}{3},
+		},
+		{
+			name:  "computed field",
+			sort:  Sort{sortByCount, sortByID},
+			value: 2,
+			want:  `((SELECT 1) > $1) OR (((SELECT 1) = $2) AND ("id" > $3))`,
+			args:  []interface{}{2, 2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after, err := tt.sort.After([]interface{}{tt.sort.String(), tt.value, 3})
+			if err != nil {
+				t.Fatalf("After() error: %v", err)
+			}
+			got, args := sqlb.Delete("t").Where(after).Build()
+			if want := `DELETE FROM "t" WHERE ` + tt.want; got != want {
+				t.Errorf("After() = %s, want %s", got, want)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("After() args = %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestSortAfterInvalidCursor(t *testing.T) {
+	sort := Sort{sortByTitle, sortByID}
+
+	tests := []struct {
+		name   string
+		cursor []interface{}
+	}{
+		{"other sort", []interface{}{"-title,id", "Go", 3}},
+		{"missing value", []interface{}{"title,id", "Go"}},
+		{"extra value", []interface{}{"title,id", "Go", 3, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := sort.After(tt.cursor); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("After(%v) error = %v, want ErrInvalidCursor", tt.cursor, err)
+			}
+		})
+	}
+}
+
+func TestSortCursorRoundTrip(t *testing.T) {
+	sort := Sort{sortByTitle, sortByID}
+
+	cursor, err := DecodeCursor(sort.Cursor([]interface{}{"Go", 3}))
+	if err != nil {
+		t.Fatalf("DecodeCursor() error: %v", err)
+	}
+	if _, err := sort.After(cursor); err != nil {
+		t.Errorf("After() of its own cursor error: %v", err)
+	}
+}
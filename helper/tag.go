@@ -0,0 +1,177 @@
+package helper
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Column is a model column, parsed from the `db:"..."` struct tag of its
+// field.
+//
+// The first element is the column name, empty means the lower cased field
+// name, and "-" skips the field. The remaining elements are options:
+//
+//	type=varchar(200)   explicit SQL type
+//	pk                  primary key
+//	notnull             NOT NULL
+//	null                nullable, value fields are NOT NULL by default and
+//	                    their zero value is stored as NULL
+//	default=<expr>      DEFAULT <expr>
+//	unique              UNIQUE constraint
+//	index               secondary index
+//	check=<expr>        CHECK (<expr>)
+//	was=<old name>      the column used to be called <old name>
+//	sort[=<name>]       list requests may sort by the column, as <name> or
+//	                    the column name
+//	search=<weight>     the column is part of the full text search column
+//	                    with weight A, B, C or D, see SearchIndex
+type Column struct {
+	Name       string
+	Skip       bool
+	Type       string
+	PrimaryKey bool
+	NotNull    bool
+	Null       bool
+	Default    string
+	Unique     bool
+	Index      bool
+	Check      string
+	Was        string
+	Sortable   bool
+	// SortName is the name given to sort by the column, empty means the
+	// column name
+	SortName string
+	Search   string
+	// Generated is the expression of a generated column, and IndexMethod
+	// the access method of its index. Both are only set on the search column.
+	Generated   string
+	IndexMethod string
+	// FieldIndex locates the field in the model, through embedded structs
+	FieldIndex []int
+}
+
+// SortKey returns the name given to sort by the column
+func (column Column) SortKey() string {
+	if column.SortName != "" {
+		return column.SortName
+	}
+	return column.Name
+}
+
+// parseColumnTag reads the db tag of a field, falling back to the legacy
+// `key:"uniq"` tag for unique columns
+func parseColumnTag(field reflect.StructField) (Column, error) {
+	tag, err := parseColumnSpec(field.Name, field.Tag.Get("db"))
+	if err != nil || tag.Skip {
+		return tag, err
+	}
+
+	if tag.Name == "" {
+		tag.Name = strings.ToLower(field.Name)
+	}
+	if strings.Contains(field.Tag.Get("key"), "uniq") {
+		tag.Unique = true
+	}
+
+	return tag, nil
+}
+
+// parseColumnSpec parses one column written in the db tag syntax, owner
+// names the field or relation it belongs to in errors
+func parseColumnSpec(owner string, spec string) (Column, error) {
+	var tag Column
+
+	parts := splitTagOptions(spec, ',')
+	if len(parts) > 0 {
+		tag.Name = strings.TrimSpace(parts[0])
+	}
+	if tag.Name == "-" {
+		tag.Skip = true
+		return tag, nil
+	}
+
+	for i := 1; i < len(parts); i++ {
+		part := strings.TrimSpace(parts[i])
+		if part == "" {
+			continue
+		}
+
+		key, value, hasValue := strings.Cut(part, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		if (hasValue != tagOptionTakesValue(key) && key != "sort") || (hasValue && value == "") {
+			return tag, fmt.Errorf("field %s: db tag option %q is malformed", owner, part)
+		}
+
+		switch key {
+		case "type":
+			tag.Type = value
+		case "pk":
+			tag.PrimaryKey = true
+		case "notnull":
+			tag.NotNull = true
+		case "null":
+			tag.Null = true
+		case "default":
+			tag.Default = value
+		case "unique":
+			tag.Unique = true
+		case "index":
+			tag.Index = true
+		case "check":
+			tag.Check = value
+		case "was":
+			tag.Was = value
+		case "sort":
+			tag.Sortable = true
+			tag.SortName = value
+		case "search":
+			tag.Search = strings.ToUpper(value)
+			if !strings.Contains("ABCD", tag.Search) || len(tag.Search) != 1 {
+				return tag, fmt.Errorf("field %s: search weight %q must be A, B, C or D", owner, value)
+			}
+		default:
+			return tag, fmt.Errorf("field %s: unknown db tag option %q", owner, key)
+		}
+	}
+
+	return tag, nil
+}
+
+// splitTagOptions splits a tag on sep when it is not inside parentheses or
+// quotes, so check and default expressions may contain commas
+func splitTagOptions(tag string, sep rune) []string {
+	if tag == "" {
+		return nil
+	}
+
+	var parts []string
+	depth := 0
+	inQuote := false
+	start := 0
+	for i, r := range tag {
+		switch {
+		case r == '\'':
+			inQuote = !inQuote
+		case inQuote:
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == sep && depth == 0:
+			parts = append(parts, tag[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, tag[start:])
+}
+
+// tagOptionTakesValue tells whether a db tag option is written as key=value
+func tagOptionTakesValue(key string) bool {
+	switch key {
+	case "type", "default", "check", "was", "search":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package helper
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseColumnSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Column
+		wantErr bool
+	}{
+		{spec: "", want: Column{}},
+		{spec: "-", want: Column{Name: "-", Skip: true}},
+		{spec: "id,pk,sort", want: Column{Name: "id", PrimaryKey: true, Sortable: true}},
+		{
+			spec: "title,type=varchar(200),notnull,check=length(title) > 0",
+			want: Column{Name: "title", Type: "varchar(200)", NotNull: true, Check: "length(title) > 0"},
+		},
+		{
+			spec: "status,default='Draft',check=status IN ('Draft', 'Published')",
+			want: Column{Name: "status", Default: "'Draft'", Check: "status IN ('Draft', 'Published')"},
+		},
+		{
+			spec: "label,default='a,b',unique,index",
+			want: Column{Name: "label", Default: "'a,b'", Unique: true, Index: true},
+		},
+		{spec: "publishdate,null,sort=publish_date", want: Column{Name: "publishdate", Null: true, Sortable: true, SortName: "publish_date"}},
+		{spec: "body, search=b ,was=content", want: Column{Name: "body", Search: "B", Was: "content"}},
+		{spec: ",NOTNULL", want: Column{NotNull: true}},
+		{spec: "a,search=E", wantErr: true},
+		{spec: "a,search=AB", wantErr: true},
+		{spec: "a,type", wantErr: true},
+		{spec: "a,type=", wantErr: true},
+		{spec: "a,pk=yes", wantErr: true},
+		{spec: "a,primary", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseColumnSpec("Field", tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseColumnSpec(%q) = %+v, want an error", tt.spec, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseColumnSpec(%q) error: %v", tt.spec, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseColumnSpec(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,13 +1,14 @@
 package logic
 
 import (
+	"api-go/helper"
 	"api-go/model"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-
-	"github.com/lib/pq"
+	"strings"
 )
 
 // CreatePost to Insert table post and post_tag
@@ -21,90 +22,72 @@ func CreatePost(db *sql.DB) http.HandlerFunc {
 		}
 
 		postID, err := InsertPost(db, post)
-		if err != nil {
+		switch {
+		case errors.Is(err, ErrUnknownTags):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, ErrInvalidPost):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		case errors.Is(err, ErrInvalidTransition):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
 			http.Error(w, "Failed to create post: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		if postID > 0 {
-			err = InsertPostTag(db, postID, post.Tags)
-			if err != nil {
-				http.Error(w, "Failed to insert post-tag relationships: "+err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			response := map[string]interface{}{
-				"id": postID,
-			}
-
-			w.WriteHeader(http.StatusCreated)
-			json.NewEncoder(w).Encode(response)
+		response := map[string]interface{}{
+			"id": postID,
 		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(response)
 	}
 }
 
-// Insert tabel post
+// InsertPost inserts a post with its tags in a single transaction and
+// returns its id. A tag given twice is kept once, at its first position.
 func InsertPost(db *sql.DB, post model.Post) (int, error) {
-	// cek all label tag
-	labels := make([]string, len(post.Tags))
-	for i, tag := range post.Tags {
-		labels[i] = tag.Label
+	if strings.TrimSpace(post.Title) == "" {
+		return 0, fmt.Errorf("%w: title is required", ErrInvalidPost)
 	}
-
-	// take id from all tag in database
-	idMap := make(map[string]int)
-	rows, err := db.Query("SELECT id, label FROM tag WHERE label = ANY($1)", pq.Array(labels))
-	if err != nil {
-		return 0, err
+	if post.Status == "" {
+		post.Status = model.PostStatusDraft
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var id int
-		var label string
-		if err := rows.Scan(&id, &label); err != nil {
-			return 0, err
-		}
-		idMap[label] = id
+	if !ValidPostStatus(post.Status) {
+		return 0, fmt.Errorf("%w: unknown status %q", ErrInvalidPost, post.Status)
 	}
-	if err := rows.Err(); err != nil {
-		return 0, err
+	if post.Status != model.PostStatusDraft {
+		return 0, fmt.Errorf("%w: posts are created as %s, not %s", ErrInvalidTransition, model.PostStatusDraft, post.Status)
 	}
+	post.ID = 0
+	post.Tags = distinctTags(post.Tags)
 
-	for _, label := range labels {
-		if _, ok := idMap[label]; !ok {
-			// Jika label tidak memiliki ID dalam database, berikan pesan kesalahan
-			return 0, fmt.Errorf("Label '%s' tidak ditemukan dalam database", label)
-		}
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, errors.New("error starting insert transaction: " + err.Error())
 	}
+	defer tx.Rollback()
 
-	if post.Status == "" {
-		post.Status = "Draft"
+	tagsMap, err := getTagsMap(tx, post.Tags)
+	if err != nil {
+		return 0, err
 	}
 
-	// query Insert post after get all id
-	postQuery := `
-		INSERT INTO post (title, content, status, publishdate) 
-		VALUES ($1, $2, $3, $4) 
-		RETURNING id
-	`
-	row := db.QueryRow(postQuery, post.Title, post.Content, post.Status, post.PublishDate)
-	var postID int
-	err = row.Scan(&postID)
+	posts, err := helper.NewRepository[model.Post](tx)
 	if err != nil {
 		return 0, err
 	}
+	if err := posts.Insert(&post); err != nil {
+		return 0, err
+	}
+	if err := UpdatePostTags(tx, post.ID, post.Tags, tagsMap); err != nil {
+		return 0, fmt.Errorf("failed to insert post tags: %w", err)
+	}
 
-	return postID, nil
-}
-
-// insert post_tag
-func InsertPostTag(db *sql.DB, postID int, tags []model.Tag) error {
-	for _, tag := range tags {
-		_, err := db.Exec("INSERT INTO post_tag (post_id, tag_id) VALUES ($1, (SELECT id FROM tag WHERE label = $2))", postID, tag.Label)
-		if err != nil {
-			return err
-		}
+	if err := tx.Commit(); err != nil {
+		return 0, errors.New("error committing insert: " + err.Error())
 	}
-	return nil
+	return post.ID, nil
 }
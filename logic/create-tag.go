@@ -1,6 +1,7 @@
 package logic
 
 import (
+	"api-go/helper"
 	"api-go/model"
 	"database/sql"
 	"encoding/json"
@@ -40,23 +41,27 @@ func CreateTag(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-// Insert tabel tag
+// Insert tabel tag, returns 0 when the label already exists
 func InsertTag(db *sql.DB, tag model.Tag) (int, error) {
-	var existingID int
-	// take id from all tag in database
-	err := db.QueryRow("SELECT id FROM tag WHERE label = $1", tag.Label).Scan(&existingID)
+	tags, err := helper.NewRepository[model.Tag](db)
 	if err != nil {
 		return 0, err
 	}
-	if err == nil {
+
+	// take tag with the same label from database
+	existing, err := tags.List(helper.Query{Where: map[string]interface{}{"label": tag.Label}, Limit: 1})
+	if err != nil {
+		return 0, err
+	}
+	if len(existing) > 0 {
 		return 0, nil
 	}
 
-	var tagID int
-	err = db.QueryRow("INSERT INTO tag (label) VALUES ($1) RETURNING id", tag.Label).Scan(&tagID)
+	tag.ID = 0
+	err = tags.Insert(&tag)
 	if err != nil {
 		return 0, err
 	}
 
-	return tagID, nil
+	return tag.ID, nil
 }
@@ -1,31 +1,34 @@
 package logic
 
 import (
+	"api-go/helper"
+	"api-go/model"
 	"database/sql"
 	"fmt"
 	"net/http"
 )
 
-// DeleteTag deletes a post along with its relations in the post_tag table based on the ID
-func DeleteTag(db *sql.DB, postID int) http.HandlerFunc {
+// DeleteTag deletes a tag based on the ID, its post_tag relations are
+// removed by the ON DELETE CASCADE of the join table
+func DeleteTag(db *sql.DB, tagID int) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// query to delete post-tag relations from the post_tag table
-		deletePostTagQuery := `DELETE FROM post_tag WHERE tag_id = $1`
-		_, err := db.Exec(deletePostTagQuery, postID)
+		tags, err := helper.NewRepository[model.Tag](db)
 		if err != nil {
-			http.Error(w, "Failed to delete post-tag relations: "+err.Error(), http.StatusInternalServerError)
+			http.Error(w, "Failed to delete tag: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		// query to delete post from the post table
-		deletePostQuery := `DELETE FROM tag WHERE id = $1`
-		_, err = db.Exec(deletePostQuery, postID)
+		deleted, err := tags.Delete(tagID)
 		if err != nil {
-			http.Error(w, "Failed to delete post: "+err.Error(), http.StatusInternalServerError)
+			http.Error(w, "Failed to delete tag: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			http.Error(w, "Tag not found", http.StatusNotFound)
 			return
 		}
 
 		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, "Post with ID %d and its relations deleted successfully", postID)
+		fmt.Fprintf(w, "Tag with ID %d and its relations deleted successfully", tagID)
 	}
 }
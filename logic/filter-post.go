@@ -0,0 +1,125 @@
+package logic
+
+import (
+	"api-go/sqlb"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// PostFilter holds the filters of a post list
+type PostFilter struct {
+	// Tags are tag labels, posts must carry any of them, or all of them
+	// when MatchAllTags is set
+	Tags         []string
+	MatchAllTags bool
+	// TagIDs are tag ids, posts must carry one of them
+	TagIDs   []int
+	Statuses []string
+	// PublishedAfter and PublishedBefore bound the publish date, the first
+	// inclusively
+	PublishedAfter  *time.Time
+	PublishedBefore *time.Time
+	// Query is a substring of the title
+	Query string
+}
+
+// ParsePostFilter reads the tag, tag_match, status, published_after,
+// published_before and q query parameters. Dates are RFC 3339 timestamps or
+// YYYY-MM-DD days.
+func ParsePostFilter(r *http.Request) (PostFilter, error) {
+	query := r.URL.Query()
+	filter := PostFilter{
+		Tags:     nonEmpty(query["tag"]),
+		Statuses: nonEmpty(query["status"]),
+		Query:    strings.TrimSpace(query.Get("q")),
+	}
+
+	switch query.Get("tag_match") {
+	case "", "any":
+	case "all":
+		filter.MatchAllTags = true
+	default:
+		return filter, errors.New("tag_match must be any or all")
+	}
+
+	var err error
+	if filter.PublishedAfter, err = parseFilterDate(query.Get("published_after")); err != nil {
+		return filter, errors.New("published_after " + err.Error())
+	}
+	if filter.PublishedBefore, err = parseFilterDate(query.Get("published_before")); err != nil {
+		return filter, errors.New("published_before " + err.Error())
+	}
+	return filter, nil
+}
+
+// Conds returns the conditions matching the posts of the filter
+func (filter PostFilter) Conds() []sqlb.Cond {
+	var conds []sqlb.Cond
+
+	if len(filter.Tags) > 0 {
+		tagged := sqlb.Select("pt.post_id").From("post_tag", "pt").
+			Join("tag", "t", sqlb.Expr(sqlb.Ident("t.id")+" = "+sqlb.Ident("pt.tag_id"))).
+			Where(sqlb.In("t.label", filter.Tags))
+		if filter.MatchAllTags {
+			tagged.GroupBy("pt.post_id").
+				Having(sqlb.Expr("COUNT(DISTINCT "+sqlb.Ident("t.label")+") = ?", len(distinct(filter.Tags))))
+		}
+		conds = append(conds, sqlb.InQuery("id", tagged))
+	}
+	if len(filter.TagIDs) > 0 {
+		tagged := sqlb.Select("post_id").From("post_tag").Where(sqlb.In("tag_id", filter.TagIDs))
+		conds = append(conds, sqlb.InQuery("id", tagged))
+	}
+	if len(filter.Statuses) > 0 {
+		conds = append(conds, sqlb.In("status", filter.Statuses))
+	}
+	if filter.PublishedAfter != nil {
+		conds = append(conds, sqlb.Cmp("publishdate", ">=", *filter.PublishedAfter))
+	}
+	if filter.PublishedBefore != nil {
+		conds = append(conds, sqlb.Cmp("publishdate", "<", *filter.PublishedBefore))
+	}
+	if filter.Query != "" {
+		conds = append(conds, sqlb.ILike("title", filter.Query))
+	}
+	return conds
+}
+
+// parseFilterDate parses an optional RFC 3339 timestamp or YYYY-MM-DD day
+func parseFilterDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return &date, nil
+		}
+	}
+	return nil, errors.New("must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+}
+
+// nonEmpty returns the values that are not blank
+func nonEmpty(values []string) []string {
+	var kept []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			kept = append(kept, value)
+		}
+	}
+	return kept
+}
+
+// distinct returns values without duplicates, in their first order
+func distinct(values []string) []string {
+	seen := make(map[string]bool)
+	var kept []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			kept = append(kept, value)
+		}
+	}
+	return kept
+}
@@ -1,32 +1,24 @@
 package logic
 
 import (
+	"api-go/helper"
 	"api-go/model"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
-	"time"
 )
 
 // GetPostByID get post by its ID
 func GetPostByID(db *sql.DB, postID int) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Query to post by ID
-		query := `
-			SELECT id, title, content, status, publishdate
-			FROM post
-			WHERE id = $1
-		`
-		row := db.QueryRow(query, postID)
-		var post model.Post
-
-		var publishDate sql.NullTime
-
-		values := []interface{}{
-			&post.ID, &post.Title, &post.Content, &post.Status, &publishDate,
+		posts, err := helper.NewRepository[model.Post](db)
+		if err != nil {
+			http.Error(w, "Failed to get post: "+err.Error(), http.StatusInternalServerError)
+			return
 		}
 
-		err := row.Scan(values...)
+		post, err := posts.FindByID(postID)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				http.Error(w, "Post not found", http.StatusNotFound)
@@ -36,106 +28,119 @@ func GetPostByID(db *sql.DB, postID int) http.HandlerFunc {
 			return
 		}
 
-		// Check if publishDate is valid
-		if publishDate.Valid {
-			post.PublishDate = publishDate.Time
-		}
-
-		// Query to get tag related post
-		tagsQuery := `
-			SELECT tag.id, tag.label
-			FROM tag
-			INNER JOIN post_tag ON tag.id = post_tag.tag_id
-			WHERE post_tag.post_id = $1
-		`
-		rows, err := db.Query(tagsQuery, postID)
+		// get tag related post
+		err = posts.Load(post, "Tags")
 		if err != nil {
 			http.Error(w, "Failed to get tags: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var label string
-			var id int
-			if err := rows.Scan(&id, &label); err != nil {
-				http.Error(w, "Failed to scan tags: "+err.Error(), http.StatusInternalServerError)
-				return
-			}
-			post.Tags = append(post.Tags, model.Tag{ID: id, Label: label})
-		}
-
-		if err := rows.Err(); err != nil {
-			http.Error(w, "Error processing tags: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(post)
 	}
 }
 
-// GetAllPosts all data posts
+// PostList is a page of posts
+type PostList struct {
+	Data []model.Post    `json:"data"`
+	Meta helper.PageMeta `json:"meta"`
+}
+
+// GetAllPosts lists posts with their tags, a page at a time, in id order
+// unless sorted otherwise. Pages are read with limit and offset, or with the
+// cursor of the previous page. Posts can be filtered, see ParsePostFilter.
 func GetAllPosts(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Query for all posts
-		query := `
-			SELECT p.id, p.title, p.content, p.status, p.publishdate, t.label
-			FROM post p
-			INNER JOIN post_tag pt ON p.id = pt.post_id
-			INNER JOIN tag t ON pt.tag_id = t.id
-		`
-		rows, err := db.Query(query)
-		if err != nil {
-			http.Error(w, "Failed to get posts: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-		defer rows.Close()
+		servePostList(db, w, r, nil)
+	}
+}
 
-		var postsMap = make(map[int]model.Post)
+// servePostList answers a post list request, restrict narrows the filters
+// of the request when not nil
+func servePostList(db *sql.DB, w http.ResponseWriter, r *http.Request, restrict func(*PostFilter)) {
+	page, err := helper.ParsePage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := ParsePostFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if restrict != nil {
+		restrict(&filter)
+	}
+	meta, err := helper.GetModelMeta(model.Post{})
+	if err != nil {
+		http.Error(w, "Failed to get posts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sort, err := helper.ParseSort(r, meta, "id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-		for rows.Next() {
-			var postID int
-			var title, content, status string
-			var publishDate sql.NullTime
-			var tagLabel string
+	list, err := ListPosts(db, filter, sort, page)
+	if errors.Is(err, helper.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get posts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-			err := rows.Scan(&postID, &title, &content, &status, &publishDate, &tagLabel)
-			if err != nil {
-				http.Error(w, "Failed to scan row: "+err.Error(), http.StatusInternalServerError)
-				return
-			}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
 
-			// Check if publishDate is valid
-			var publishTime time.Time
-			if publishDate.Valid {
-				publishTime = publishDate.Time
-			}
+// ListPosts returns a page of the posts matching filter in sort order with
+// their tags. The total counts every matching post.
+func ListPosts(db *sql.DB, filter PostFilter, sort helper.Sort, page helper.Page) (*PostList, error) {
+	posts, err := helper.NewRepository[model.Post](db)
+	if err != nil {
+		return nil, err
+	}
 
-			// Check if post already exists in map, if not create new post
-			post, ok := postsMap[postID]
-			if !ok {
-				post = model.Post{
-					ID:          postID,
-					Title:       title,
-					Content:     content,
-					Status:      status,
-					PublishDate: publishTime,
-					Tags:        []model.Tag{},
-				}
-			}
+	conds := filter.Conds()
+	total, err := posts.Count(helper.Query{Conds: conds})
+	if err != nil {
+		return nil, err
+	}
 
-			post.Tags = append(post.Tags, model.Tag{Label: tagLabel})
-			postsMap[postID] = post
+	query := helper.Query{Conds: conds, OrderBy: sort.OrderBy(), Limit: page.Limit + 1, Offset: page.Offset}
+	if page.Cursor != nil {
+		after, err := sort.After(page.Cursor)
+		if err != nil {
+			return nil, err
 		}
+		query.Conds = append(query.Conds, after)
+	}
 
-		// Convert map to slice of posts
-		var posts []model.Post
-		for _, post := range postsMap {
-			posts = append(posts, post)
+	// one more row than asked tells whether there is a next page
+	list, err := posts.List(query)
+	if page.Cursor != nil && helper.IsInvalidValueError(err) {
+		return nil, helper.ErrInvalidCursor
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	meta := helper.PageMeta{Total: total, Limit: page.Limit, Offset: page.Offset}
+	if len(list) > page.Limit {
+		list = list[:page.Limit]
+		values, err := posts.SortValues(sort, &list[len(list)-1])
+		if err != nil {
+			return nil, err
 		}
+		cursor := sort.Cursor(values)
+		meta.NextCursor = &cursor
+	}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(posts)
+	if err := posts.LoadRelation(list, "Tags"); err != nil {
+		return nil, err
 	}
+	return &PostList{Data: list, Meta: meta}, nil
 }
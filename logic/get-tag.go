@@ -1,27 +1,177 @@
 package logic
 
 import (
+	"api-go/helper"
 	"api-go/model"
+	"api-go/sqlb"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 )
 
 // GetTagByID get tag by its ID
 func GetTagByID(db *sql.DB, tagID int) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Query to get tag by ID
-		query := `SELECT id, label FROM tag WHERE id = $1`
-		row := db.QueryRow(query, tagID)
-		var tag model.Tag
-
-		err := row.Scan(&tag.ID, &tag.Label)
+		tags, err := helper.NewRepository[model.Tag](db)
 		if err != nil {
 			http.Error(w, "Failed to get tag: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		tag, err := tags.FindByID(tagID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Tag not found", http.StatusNotFound)
+			} else {
+				http.Error(w, "Failed to get tag: "+err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(tag)
 	}
 }
+
+// TagCount is a tag with the number of posts carrying it
+type TagCount struct {
+	model.Tag
+	PostCount int `json:"post_count"`
+}
+
+// TagList is a page of tags
+type TagList struct {
+	Data []TagCount      `json:"data"`
+	Meta helper.PageMeta `json:"meta"`
+}
+
+// postCountSort sorts tags by popularity, the number of posts carrying them
+var postCountSort = helper.SortField{
+	Name:   "post_count",
+	Column: "post_count",
+	Expr:   "(SELECT COUNT(*) FROM " + sqlb.Ident("post_tag") + " WHERE " + sqlb.Ident("post_tag.tag_id") + " = " + sqlb.Ident("tag.id") + ")",
+}
+
+// GetAllTags lists tags with their post count, a page at a time, in label
+// order unless sorted otherwise, e.g. by popularity with sort=-post_count.
+// Pages are read with limit and offset, or with the cursor of the previous
+// page.
+func GetAllTags(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, err := helper.ParsePage(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		meta, err := helper.GetModelMeta(model.Tag{})
+		if err != nil {
+			http.Error(w, "Failed to get tags: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sort, err := helper.ParseSort(r, meta, "label", postCountSort)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		list, err := ListTags(db, sort, page)
+		if errors.Is(err, helper.ErrInvalidCursor) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to get tags: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+// ListTags returns a page of tags in sort order with their post count
+func ListTags(db *sql.DB, sort helper.Sort, page helper.Page) (*TagList, error) {
+	tags, err := helper.NewRepository[model.Tag](db)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := tags.Count(helper.Query{})
+	if err != nil {
+		return nil, err
+	}
+
+	sel := sqlb.Select(tags.Meta().ColumnNames()...).
+		ColumnExpr(postCountSort.Expr).
+		From(tags.Meta().Table)
+	if page.Cursor != nil {
+		after, err := sort.After(page.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		sel.Where(after)
+	}
+	sort.Apply(sel)
+
+	// one more row than asked tells whether there is a next page
+	query, args := sel.Limit(page.Limit + 1).Offset(page.Offset).Build()
+	rows, err := db.Query(query, args...)
+	if page.Cursor != nil && helper.IsInvalidValueError(err) {
+		return nil, helper.ErrInvalidCursor
+	}
+	if err != nil {
+		return nil, errors.New("error listing tags: " + err.Error())
+	}
+	defer rows.Close()
+
+	list := TagList{Data: []TagCount{}, Meta: helper.PageMeta{Total: total, Limit: page.Limit, Offset: page.Offset}}
+	for rows.Next() {
+		var tag TagCount
+		dest := append(tags.Meta().ScanDest(&tag.Tag), &tag.PostCount)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, errors.New("error scanning tags: " + err.Error())
+		}
+		list.Data = append(list.Data, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(list.Data) > page.Limit {
+		list.Data = list.Data[:page.Limit]
+		last := list.Data[len(list.Data)-1]
+		byColumn := map[string]interface{}{"id": last.ID, "label": last.Label, "post_count": last.PostCount}
+		values := make([]interface{}, len(sort))
+		for i, field := range sort {
+			values[i] = byColumn[field.Column]
+		}
+		cursor := sort.Cursor(values)
+		list.Meta.NextCursor = &cursor
+	}
+	return &list, nil
+}
+
+// GetTagPosts lists the posts carrying a tag, like GetAllPosts
+func GetTagPosts(db *sql.DB, tagID int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tags, err := helper.NewRepository[model.Tag](db)
+		if err != nil {
+			http.Error(w, "Failed to get tag: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := tags.FindByID(tagID); err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Tag not found", http.StatusNotFound)
+			} else {
+				http.Error(w, "Failed to get tag: "+err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		servePostList(db, w, r, func(filter *PostFilter) {
+			filter.TagIDs = []int{tagID}
+		})
+	}
+}
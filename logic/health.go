@@ -0,0 +1,133 @@
+package logic
+
+import (
+	"api-go/helper"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// readyTimeout bounds the database checks of a readiness probe
+const readyTimeout = 2 * time.Second
+
+// Health answers the liveness, readiness and status probes
+type Health struct {
+	db           *sql.DB
+	migrations   []helper.Migration
+	version      string
+	startedAt    time.Time
+	shuttingDown atomic.Bool
+}
+
+// NewHealth returns the probes of a service running version against db,
+// ready once every migration is applied
+func NewHealth(db *sql.DB, migrations []helper.Migration, version string) *Health {
+	return &Health{db: db, migrations: migrations, version: version, startedAt: time.Now()}
+}
+
+// SetShuttingDown makes the readiness probe fail, so load balancers stop
+// sending requests while the server drains
+func (h *Health) SetShuttingDown() {
+	h.shuttingDown.Store(true)
+}
+
+// Healthz tells the process is alive
+func (h *Health) Healthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, http.StatusOK, map[string]interface{}{"status": "ok"})
+	}
+}
+
+// Readyz tells the service can take requests: it is not shutting down, the
+// database answers and every migration is applied
+func (h *Health) Readyz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if problem, _ := h.check(r.Context()); problem != "" {
+			writeHealth(w, http.StatusServiceUnavailable, map[string]interface{}{"status": "unavailable", "reason": problem})
+			return
+		}
+		writeHealth(w, http.StatusOK, map[string]interface{}{"status": "ok"})
+	}
+}
+
+// Status reports the readiness with the version, uptime, connection pool
+// and migrations of the service
+func (h *Health) Status() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := map[string]interface{}{
+			"status":     "ok",
+			"version":    h.version,
+			"started_at": h.startedAt.UTC().Format(time.RFC3339),
+			"uptime":     time.Since(h.startedAt).Round(time.Second).String(),
+		}
+
+		code := http.StatusOK
+		problem, statuses := h.check(r.Context())
+		if problem != "" {
+			code = http.StatusServiceUnavailable
+			status["status"] = "unavailable"
+			status["reason"] = problem
+		}
+
+		stats := h.db.Stats()
+		status["db"] = map[string]interface{}{
+			"max_open_connections": stats.MaxOpenConnections,
+			"open_connections":     stats.OpenConnections,
+			"in_use":               stats.InUse,
+			"idle":                 stats.Idle,
+			"wait_count":           stats.WaitCount,
+			"wait_duration":        stats.WaitDuration.String(),
+			"max_idle_closed":      stats.MaxIdleClosed,
+			"max_idle_time_closed": stats.MaxIdleTimeClosed,
+			"max_lifetime_closed":  stats.MaxLifetimeClosed,
+		}
+
+		if statuses != nil {
+			applied := 0
+			for _, migration := range statuses {
+				if migration.Applied {
+					applied++
+				}
+			}
+			status["migrations"] = map[string]interface{}{"applied": applied, "pending": len(statuses) - applied}
+		}
+
+		writeHealth(w, code, status)
+	}
+}
+
+// check returns why the service is not ready, or an empty string, with the
+// status of the migrations when they could be read
+func (h *Health) check(ctx context.Context) (string, []helper.MigrationStatus) {
+	if h.shuttingDown.Load() {
+		return "shutting down", nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+	if err := h.db.PingContext(ctx); err != nil {
+		return "database unreachable: " + helper.Redact(err.Error()), nil
+	}
+
+	statuses, err := helper.GetMigrationStatus(h.db, h.migrations)
+	if err != nil {
+		return "cannot read migrations: " + helper.Redact(err.Error()), nil
+	}
+	for _, status := range statuses {
+		if !status.Applied {
+			return "migrations pending", statuses
+		}
+	}
+	return "", statuses
+}
+
+// writeHealth writes a probe response, never cached
+func writeHealth(w http.ResponseWriter, code int, body map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,75 @@
+package logic
+
+import (
+	"api-go/helper"
+	"api-go/model"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// maxPatchSize bounds the body of a patch request
+const maxPatchSize = 1 << 20
+
+// PatchPost changes part of a post, with a JSON merge patch (RFC 7396) or a
+// JSON patch (RFC 6902) of its JSON form, tags included. Fields the patch
+// leaves out keep their value, those it sets to "" or [] are emptied.
+func PatchPost(db *sql.DB, postID int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Patch", helper.MergePatchType+", "+helper.JSONPatchType)
+
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		var apply func(doc, patch []byte) ([]byte, error)
+		switch mediaType {
+		case helper.MergePatchType:
+			apply = helper.MergePatch
+		case helper.JSONPatchType:
+			apply = helper.JSONPatch
+		default:
+			http.Error(w, "Content-Type must be "+helper.MergePatchType+" or "+helper.JSONPatchType, http.StatusUnsupportedMediaType)
+			return
+		}
+
+		patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPatchSize))
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		post, err := ReplacePost(db, postID, func(current *model.Post) (*model.Post, error) {
+			return patchPost(current, patch, apply)
+		})
+		if err != nil {
+			writeUpdateError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(post)
+	}
+}
+
+// patchPost applies a patch to the JSON form of a post and returns the
+// patched post
+func patchPost(current *model.Post, patch []byte, apply func(doc, patch []byte) ([]byte, error)) (*model.Post, error) {
+	doc, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := apply(doc, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	var post model.Post
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&post); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPost, err)
+	}
+	return &post, nil
+}
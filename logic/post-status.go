@@ -0,0 +1,90 @@
+package logic
+
+import (
+	"api-go/model"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrInvalidTransition is returned when a post is moved to a status its
+// current status does not lead to
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// postTransitions lists the statuses each status of the lifecycle leads to
+var postTransitions = map[string][]string{
+	model.PostStatusDraft:     {model.PostStatusInReview},
+	model.PostStatusInReview:  {model.PostStatusDraft, model.PostStatusPublished},
+	model.PostStatusPublished: {model.PostStatusArchived},
+	model.PostStatusArchived:  {model.PostStatusDraft},
+}
+
+// ValidPostStatus tells whether status is a status of the post lifecycle
+func ValidPostStatus(status string) bool {
+	_, ok := postTransitions[status]
+	return ok
+}
+
+// CheckTransition returns nil when a post may move from one status to the
+// other, ErrInvalidPost when to is not a status and ErrInvalidTransition when
+// from does not lead to it
+func CheckTransition(from, to string) error {
+	if !ValidPostStatus(to) {
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidPost, to)
+	}
+	for _, next := range postTransitions[from] {
+		if next == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w from %s to %s, %s leads to %s", ErrInvalidTransition, from, to, from, strings.Join(postTransitions[from], ", "))
+}
+
+// stampPublishDate sets the publish date of a published post when it is unset
+func stampPublishDate(post *model.Post) {
+	if post.Status == model.PostStatusPublished && post.PublishDate == nil {
+		now := time.Now().UTC()
+		post.PublishDate = &now
+	}
+}
+
+// TransitionPost moves a post to the status of the request, e.g.
+// {"status": "Published"}, and answers the updated post. Moves the
+// lifecycle does not allow are rejected with 409.
+func TransitionPost(db *sql.DB, postID int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var transition struct {
+			Status string `json:"status"`
+		}
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&transition); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		if transition.Status == "" {
+			http.Error(w, "status is required", http.StatusBadRequest)
+			return
+		}
+
+		post, err := ReplacePost(db, postID, func(current *model.Post) (*model.Post, error) {
+			if err := CheckTransition(current.Status, transition.Status); err != nil {
+				return nil, err
+			}
+			updated := *current
+			updated.Status = transition.Status
+			return &updated, nil
+		})
+		if err != nil {
+			writeUpdateError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(post)
+	}
+}
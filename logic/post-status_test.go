@@ -0,0 +1,101 @@
+package logic
+
+import (
+	"api-go/model"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckTransition(t *testing.T) {
+	const (
+		draft     = model.PostStatusDraft
+		inReview  = model.PostStatusInReview
+		published = model.PostStatusPublished
+		archived  = model.PostStatusArchived
+	)
+
+	tests := []struct {
+		from, to string
+		want     error
+	}{
+		{draft, draft, ErrInvalidTransition},
+		{draft, inReview, nil},
+		{draft, published, ErrInvalidTransition},
+		{draft, archived, ErrInvalidTransition},
+		{inReview, draft, nil},
+		{inReview, inReview, ErrInvalidTransition},
+		{inReview, published, nil},
+		{inReview, archived, ErrInvalidTransition},
+		{published, draft, ErrInvalidTransition},
+		{published, inReview, ErrInvalidTransition},
+		{published, published, ErrInvalidTransition},
+		{published, archived, nil},
+		{archived, draft, nil},
+		{archived, inReview, ErrInvalidTransition},
+		{archived, published, ErrInvalidTransition},
+		{archived, archived, ErrInvalidTransition},
+		{draft, "Deleted", ErrInvalidPost},
+		{draft, "draft", ErrInvalidPost},
+		{draft, "", ErrInvalidPost},
+		{"Deleted", draft, ErrInvalidTransition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+" -> "+tt.to, func(t *testing.T) {
+			err := CheckTransition(tt.from, tt.to)
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("CheckTransition(%q, %q) error: %v", tt.from, tt.to, err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("CheckTransition(%q, %q) error = %v, want %v", tt.from, tt.to, err, tt.want)
+			}
+		})
+	}
+}
+
+// posts are created as drafts, before any query is run
+func TestInsertPostStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		want   error
+	}{
+		{model.PostStatusInReview, ErrInvalidTransition},
+		{model.PostStatusPublished, ErrInvalidTransition},
+		{model.PostStatusArchived, ErrInvalidTransition},
+		{"Deleted", ErrInvalidPost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			_, err := InsertPost(nil, model.Post{Title: "Go", Status: tt.status})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("InsertPost() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteUpdateErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{CheckTransition(model.PostStatusDraft, model.PostStatusPublished), http.StatusConflict},
+		{CheckTransition(model.PostStatusDraft, "Deleted"), http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeUpdateError(w, tt.err)
+			if w.Code != tt.want {
+				t.Errorf("writeUpdateError(%v) status = %d, want %d", tt.err, w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package logic
+
+import (
+	"api-go/helper"
+	"api-go/model"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// PostHit is a post found by a search, with its rank and a snippet of its
+// content where matches are wrapped in <mark>
+type PostHit struct {
+	model.Post
+	Rank     float64 `json:"rank"`
+	Headline string  `json:"headline"`
+}
+
+// PostHitList is a page of search results
+type PostHitList struct {
+	Data []PostHit       `json:"data"`
+	Meta helper.PageMeta `json:"meta"`
+}
+
+// SearchPosts searches the title and content of posts, best matches first.
+// q is written in the web search syntax and parsed with the text search
+// configuration of the post search column. Results are paged with limit and
+// offset and can be filtered like GetAllPosts, except q.
+func SearchPosts(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		search := helper.TextSearch{
+			Query:    strings.TrimSpace(r.URL.Query().Get("q")),
+			Headline: "content",
+		}
+		if search.Query == "" {
+			http.Error(w, "q is required", http.StatusBadRequest)
+			return
+		}
+
+		page, err := helper.ParsePage(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if page.Cursor != nil {
+			http.Error(w, "search results are paged with offset, not cursor", http.StatusBadRequest)
+			return
+		}
+		filter, err := ParsePostFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// q is the search itself here
+		filter.Query = ""
+
+		list, err := FindPosts(db, search, filter, page)
+		if err != nil {
+			http.Error(w, "Failed to search posts: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+// FindPosts returns a page of the posts found by a search and matching
+// filter, with their tags
+func FindPosts(db *sql.DB, search helper.TextSearch, filter PostFilter, page helper.Page) (*PostHitList, error) {
+	posts, err := helper.NewRepository[model.Post](db)
+	if err != nil {
+		return nil, err
+	}
+
+	match, err := posts.Match(search)
+	if err != nil {
+		return nil, err
+	}
+	conds := filter.Conds()
+	total, err := posts.Count(helper.Query{Conds: append(conds, match)})
+	if err != nil {
+		return nil, err
+	}
+
+	hits, err := posts.Search(search, helper.Query{Conds: conds, Limit: page.Limit, Offset: page.Offset})
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]model.Post, len(hits))
+	for i, hit := range hits {
+		list[i] = hit.Model
+	}
+	if err := posts.LoadRelation(list, "Tags"); err != nil {
+		return nil, err
+	}
+
+	result := &PostHitList{Data: []PostHit{}, Meta: helper.PageMeta{Total: total, Limit: page.Limit, Offset: page.Offset}}
+	for i, hit := range hits {
+		result.Data = append(result.Data, PostHit{Post: list[i], Rank: hit.Rank, Headline: hit.Headline})
+	}
+	return result, nil
+}
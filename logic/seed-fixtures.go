@@ -0,0 +1,256 @@
+package logic
+
+import (
+	"api-go/helper"
+	"api-go/model"
+	"api-go/sqlb"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Fixtures are the tags and posts of one or more fixture sets
+type Fixtures struct {
+	Tags  []TagFixture  `yaml:"tags" json:"tags"`
+	Posts []PostFixture `yaml:"posts" json:"posts"`
+}
+
+// TagFixture is a tag, identified by its label
+type TagFixture struct {
+	Label string `yaml:"label" json:"label"`
+}
+
+// PostFixture is a post, identified by its title. Tags lists tag labels.
+type PostFixture struct {
+	Title       string     `yaml:"title" json:"title"`
+	Content     string     `yaml:"content" json:"content"`
+	Status      string     `yaml:"status" json:"status"`
+	PublishDate *time.Time `yaml:"publish_date" json:"publish_date"`
+	Tags        []string   `yaml:"tags" json:"tags"`
+}
+
+// SeedResult counts the rows written by SeedFixtures
+type SeedResult struct {
+	Tags         int
+	PostsCreated int
+	PostsUpdated int
+}
+
+// LoadFixtures reads the .yaml, .yml and .json files of each fixture set, a
+// directory of fsys named after the set. Files are read in name order.
+func LoadFixtures(fsys fs.FS, sets ...string) (*Fixtures, error) {
+	fixtures := &Fixtures{}
+	for _, set := range sets {
+		entries, err := fs.ReadDir(fsys, set)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("unknown fixture set %q", set)
+			}
+			return nil, fmt.Errorf("error reading fixture set %s: %v", set, err)
+		}
+
+		for _, entry := range entries {
+			ext := path.Ext(entry.Name())
+			if entry.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+				continue
+			}
+
+			name := path.Join(set, entry.Name())
+			content, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return nil, fmt.Errorf("error reading fixture %s: %v", name, err)
+			}
+
+			var file Fixtures
+			if ext == ".json" {
+				decoder := json.NewDecoder(bytes.NewReader(content))
+				decoder.DisallowUnknownFields()
+				err = decoder.Decode(&file)
+			} else {
+				err = yaml.UnmarshalStrict(content, &file)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("error parsing fixture %s: %v", name, err)
+			}
+
+			fixtures.Tags = append(fixtures.Tags, file.Tags...)
+			fixtures.Posts = append(fixtures.Posts, file.Posts...)
+		}
+	}
+
+	return fixtures, fixtures.validate()
+}
+
+// validate checks the fixtures can be seeded
+func (fixtures *Fixtures) validate() error {
+	for _, tag := range fixtures.Tags {
+		if strings.TrimSpace(tag.Label) == "" {
+			return errors.New("tag fixture without a label")
+		}
+	}
+
+	titles := make(map[string]bool)
+	for _, post := range fixtures.Posts {
+		if strings.TrimSpace(post.Title) == "" {
+			return errors.New("post fixture without a title")
+		}
+		if titles[post.Title] {
+			return fmt.Errorf("post %q is defined twice", post.Title)
+		}
+		titles[post.Title] = true
+		if post.Status != "" && !ValidPostStatus(post.Status) {
+			return fmt.Errorf("post %q has unknown status %q", post.Title, post.Status)
+		}
+	}
+	return nil
+}
+
+// SeedFixtures upserts the fixtures in a single transaction, tags first.
+// Tags are matched by label and posts by title, the tags of a post are
+// replaced by those of its fixture, so seeding twice changes nothing. Posts
+// may reference tags of the fixtures or tags already in the database.
+func SeedFixtures(db *sql.DB, fixtures *Fixtures) (SeedResult, error) {
+	var result SeedResult
+
+	tx, err := db.Begin()
+	if err != nil {
+		return result, errors.New("error starting seed transaction: " + err.Error())
+	}
+	defer tx.Rollback()
+
+	tagIDs, err := seedTags(tx, fixtures, &result)
+	if err != nil {
+		return result, err
+	}
+
+	posts, err := helper.NewRepository[model.Post](tx)
+	if err != nil {
+		return result, err
+	}
+	for _, fixture := range fixtures.Posts {
+		err := seedPost(tx, posts, fixture, tagIDs, &result)
+		if err != nil {
+			return result, fmt.Errorf("error seeding post %q: %v", fixture.Title, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return result, errors.New("error committing seed: " + err.Error())
+	}
+	return result, nil
+}
+
+// seedTags upserts the tag fixtures and returns the ids of every tag the
+// fixtures use, by label
+func seedTags(tx *sql.Tx, fixtures *Fixtures, result *SeedResult) (map[string]int, error) {
+	tagIDs := make(map[string]int)
+	for _, fixture := range fixtures.Tags {
+		if _, ok := tagIDs[fixture.Label]; ok {
+			continue
+		}
+
+		// updating the label to itself makes RETURNING give the id of an
+		// existing tag too
+		query, args := sqlb.Insert("tag").Columns("label").Values(fixture.Label).
+			OnConflictDoUpdate([]string{"label"}, "label").
+			Returning("id").
+			Build()
+		var id int
+		if err := tx.QueryRow(query, args...).Scan(&id); err != nil {
+			return nil, fmt.Errorf("error seeding tag %q: %v", fixture.Label, err)
+		}
+		tagIDs[fixture.Label] = id
+		result.Tags++
+	}
+
+	// the other labels must exist already
+	var missing []string
+	for _, post := range fixtures.Posts {
+		for _, label := range post.Tags {
+			if _, ok := tagIDs[label]; !ok {
+				missing = append(missing, label)
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return tagIDs, nil
+	}
+
+	tags, err := helper.NewRepository[model.Tag](tx)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := tags.List(helper.Query{Where: map[string]interface{}{"label": missing}})
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range existing {
+		tagIDs[tag.Label] = tag.ID
+	}
+
+	var unknown []string
+	for _, label := range missing {
+		if _, ok := tagIDs[label]; !ok {
+			unknown = append(unknown, label)
+			tagIDs[label] = 0
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("posts use unknown tags %q, add them to the fixtures", unknown)
+	}
+	return tagIDs, nil
+}
+
+// seedPost inserts or updates the post of a fixture and replaces its tags
+func seedPost(tx *sql.Tx, posts *helper.Repository[model.Post], fixture PostFixture, tagIDs map[string]int, result *SeedResult) error {
+	post := model.Post{
+		Title:       fixture.Title,
+		Content:     fixture.Content,
+		Status:      fixture.Status,
+		PublishDate: fixture.PublishDate,
+	}
+	if post.Status == "" {
+		post.Status = model.PostStatusDraft
+	}
+
+	existing, err := posts.List(helper.Query{Where: map[string]interface{}{"title": fixture.Title}, OrderBy: []string{"id"}, Limit: 1})
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		post.ID = existing[0].ID
+		err = posts.Update(&post, "content", "status", "publishdate")
+		result.PostsUpdated++
+	} else {
+		err = posts.Insert(&post)
+		result.PostsCreated++
+	}
+	if err != nil {
+		return err
+	}
+
+	query, args := sqlb.Delete("post_tag").Where(sqlb.Eq("post_id", post.ID)).Build()
+	if _, err := tx.Exec(query, args...); err != nil {
+		return err
+	}
+	for position, label := range fixture.Tags {
+		query, args := sqlb.Insert("post_tag").Columns("post_id", "tag_id", "position").
+			Values(post.ID, tagIDs[label], position).
+			OnConflictDoNothing().
+			Build()
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,14 +1,22 @@
 package logic
 
 import (
+	"api-go/helper"
 	"api-go/model"
+	"api-go/sqlb"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
+	"time"
 )
 
-// UpdatePost to update data post
+// UpdatePost replaces a post: every field and the tags are set to those of
+// the request, missing fields are emptied and missing tags removed. A
+// missing status keeps the current one.
 func UpdatePost(db *sql.DB, postID int) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var updatedPost model.Post
@@ -17,77 +25,192 @@ func UpdatePost(db *sql.DB, postID int) http.HandlerFunc {
 			http.Error(w, "Invalid request payload", http.StatusBadRequest)
 			return
 		}
-
-		// get all tag for table
-		tagsMap, err := getAllTagsMap(db)
+		post, err := ReplacePost(db, postID, func(current *model.Post) (*model.Post, error) {
+			if updatedPost.Status == "" {
+				updatedPost.Status = current.Status
+			}
+			return &updatedPost, nil
+		})
 		if err != nil {
-			http.Error(w, "Failed to retrieve tags: "+err.Error(), http.StatusInternalServerError)
+			writeUpdateError(w, err)
 			return
 		}
 
-		// Cek tag in post
-		for _, tag := range updatedPost.Tags {
-			if _, exists := tagsMap[tag.Label]; !exists {
-				http.Error(w, "Tag '"+tag.Label+"' does not exist", http.StatusBadRequest)
-				return
-			}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(post)
+	}
+}
+
+// ErrUnknownTags is returned when a post is given tags that do not exist
+var ErrUnknownTags = errors.New("unknown tags")
+
+// ErrInvalidPost is returned when the new state of a post breaks a rule of
+// the API, such as changing its id
+var ErrInvalidPost = errors.New("invalid post")
+
+// ReplacePost replaces a post with the one returned by change, which is
+// given the current post with its tags. The post row is locked while it
+// changes, so concurrent updates apply one after the other. Only the
+// columns that differ are written, and the tags when their labels differ.
+// A new status must follow the lifecycle, see CheckTransition, and
+// publishing stamps the publish date when it is unset.
+// It returns the stored post with its tags, sql.ErrNoRows when there is no
+// such post.
+func ReplacePost(db *sql.DB, postID int, change func(current *model.Post) (*model.Post, error)) (*model.Post, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, errors.New("error starting update transaction: " + err.Error())
+	}
+	defer tx.Rollback()
+
+	posts, err := helper.NewRepository[model.Post](tx)
+	if err != nil {
+		return nil, err
+	}
+
+	query, args := sqlb.Select("id").From("post").Where(sqlb.Eq("id", postID)).ForUpdate().Build()
+	if err := tx.QueryRow(query, args...).Scan(&postID); err != nil {
+		return nil, err
+	}
+	current, err := posts.FindByID(postID)
+	if err != nil {
+		return nil, err
+	}
+	if err := posts.Load(current, "Tags"); err != nil {
+		return nil, err
+	}
+
+	updated, err := change(current)
+	if err != nil {
+		return nil, err
+	}
+	if updated.ID != 0 && updated.ID != postID {
+		return nil, fmt.Errorf("%w: id cannot be changed", ErrInvalidPost)
+	}
+	if strings.TrimSpace(updated.Title) == "" {
+		return nil, fmt.Errorf("%w: title is required", ErrInvalidPost)
+	}
+	updated.ID = postID
+	updated.Tags = distinctTags(updated.Tags)
+	if updated.Status != current.Status {
+		if err := CheckTransition(current.Status, updated.Status); err != nil {
+			return nil, err
 		}
+		stampPublishDate(updated)
+	}
 
-		err = UpdateQueryPost(db, updatedPost, postID)
-		if err != nil {
-			http.Error(w, "Failed to UpdateQueryPost: "+err.Error(), http.StatusInternalServerError)
+	var columns []string
+	if updated.Title != current.Title {
+		columns = append(columns, "title")
+	}
+	if updated.Content != current.Content {
+		columns = append(columns, "content")
+	}
+	if updated.Status != current.Status {
+		columns = append(columns, "status")
+	}
+	if !samePublishDate(updated.PublishDate, current.PublishDate) {
+		columns = append(columns, "publishdate")
+	}
+	if len(columns) > 0 {
+		if err := posts.Update(updated, columns...); err != nil {
+			return nil, fmt.Errorf("failed to update post: %w", err)
 		}
+	}
 
-		// Cek if any change to tag
-		if len(updatedPost.Tags) > 0 {
-			// Update post_tag
-			err = UpdatePostTags(db, postID, updatedPost.Tags, tagsMap)
-			if err != nil {
-				http.Error(w, "Failed to update post tags: "+err.Error(), http.StatusInternalServerError)
-				return
-			}
+	if !sameTags(current.Tags, updated.Tags) {
+		tagsMap, err := getTagsMap(tx, updated.Tags)
+		if err != nil {
+			return nil, err
 		}
+		if err := UpdatePostTags(tx, postID, updated.Tags, tagsMap); err != nil {
+			return nil, fmt.Errorf("failed to update post tags: %w", err)
+		}
+	}
 
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(updatedPost)
+	if err := posts.Load(updated, "Tags"); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.New("error committing update: " + err.Error())
 	}
+	return updated, nil
 }
 
-func UpdateQueryPost(db *sql.DB, updatedPost model.Post, postID int) error {
-	args := []interface{}{}
-
-	if updatedPost.Title != "" {
-		args = append(args, updatedPost.Title)
+// writeUpdateError answers a failed update of a post
+func writeUpdateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Post not found", http.StatusNotFound)
+	case errors.Is(err, ErrUnknownTags):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrInvalidPost):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, ErrInvalidTransition):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, helper.ErrPatchTestFailed):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, helper.ErrInvalidPatch):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "Failed to update post: "+err.Error(), http.StatusInternalServerError)
 	}
+}
 
-	if updatedPost.Content != "" {
-		args = append(args, updatedPost.Content)
+// samePublishDate tells whether two publish dates are both unset or the same
+// instant
+func samePublishDate(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
 	}
+	return a.Equal(*b)
+}
 
-	if len(args) == 0 {
-		return fmt.Errorf("no valid fields to update")
+// distinctTags returns the tags without the repeated labels, in order
+func distinctTags(tags []model.Tag) []model.Tag {
+	seen := make(map[string]bool)
+	var kept []model.Tag
+	for _, tag := range tags {
+		if !seen[tag.Label] {
+			seen[tag.Label] = true
+			kept = append(kept, tag)
+		}
 	}
+	return kept
+}
 
-	args = append(args, postID)
-	updateQuery := fmt.Sprintf("UPDATE post SET title = $1, content = $2 WHERE id = $%d", len(args))
-
-	_, err := db.Exec(updateQuery, args...)
-	if err != nil {
-		return fmt.Errorf("failed to update post: %w", err)
+// sameTags tells whether two tag lists have the same labels in the same order
+func sameTags(a, b []model.Tag) bool {
+	if len(a) != len(b) {
+		return false
 	}
-
-	return nil
+	for i := range a {
+		if a[i].Label != b[i].Label {
+			return false
+		}
+	}
+	return true
 }
 
-// getAllTagsMap get all tags from table and return map
-func getAllTagsMap(db *sql.DB) (map[string]int, error) {
-	rows, err := db.Query("SELECT id, label FROM tag")
+// getTagsMap returns the ids of the tags, by label. It fails with
+// ErrUnknownTags when a tag does not exist.
+func getTagsMap(db helper.Querier, tags []model.Tag) (map[string]int, error) {
+	tagsMap := make(map[string]int)
+	if len(tags) == 0 {
+		return tagsMap, nil
+	}
+
+	labels := make([]string, len(tags))
+	for i, tag := range tags {
+		labels[i] = tag.Label
+	}
+	query, args := sqlb.Select("id", "label").From("tag").Where(sqlb.In("label", labels)).Build()
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	tagsMap := make(map[string]int)
 	for rows.Next() {
 		var id int
 		var label string
@@ -96,24 +219,40 @@ func getAllTagsMap(db *sql.DB) (map[string]int, error) {
 		}
 		tagsMap[label] = id
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var unknown []string
+	for _, label := range labels {
+		if _, ok := tagsMap[label]; !ok {
+			unknown = append(unknown, label)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("%w %q", ErrUnknownTags, unknown)
+	}
 	return tagsMap, nil
 }
 
 // UpdatePostTags updates the tags with a post
-func UpdatePostTags(db *sql.DB, postID int, tags []model.Tag, tagsMap map[string]int) error {
+func UpdatePostTags(db helper.Querier, postID int, tags []model.Tag, tagsMap map[string]int) error {
 	// Delete existing tags for the post
-	_, err := db.Exec("DELETE FROM post_tag WHERE post_id = $1", postID)
+	query, args := sqlb.Delete("post_tag").Where(sqlb.Eq("post_id", postID)).Build()
+	_, err := db.Exec(query, args...)
 	if err != nil {
 		return err
 	}
 
 	// Insert new tags for the post
-	for _, tag := range tags {
+	for position, tag := range tags {
 		tagID, exists := tagsMap[tag.Label]
 		if !exists {
 			return fmt.Errorf("Tag '%s' does not exist", tag.Label)
 		}
-		_, err = db.Exec("INSERT INTO post_tag (post_id, tag_id) VALUES ($1, $2)", postID, tagID)
+		query, args := sqlb.Insert("post_tag").Columns("post_id", "tag_id", "position").Values(postID, tagID, position).Build()
+		_, err = db.Exec(query, args...)
 		if err != nil {
 			return err
 		}
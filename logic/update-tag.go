@@ -1,6 +1,7 @@
 package logic
 
 import (
+	"api-go/helper"
 	"api-go/model"
 	"database/sql"
 	"encoding/json"
@@ -17,13 +18,23 @@ func UpdateTag(db *sql.DB, tagID int) http.HandlerFunc {
 			return
 		}
 
-		updateQuery := "UPDATE tag SET label = $1 WHERE id = $2"
-		_, err = db.Exec(updateQuery, updatedtag.Label, tagID)
+		tags, err := helper.NewRepository[model.Tag](db)
 		if err != nil {
 			http.Error(w, "Failed to update tag: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		updatedtag.ID = tagID
+		err = tags.Update(&updatedtag, "label")
+		if err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Tag not found", http.StatusNotFound)
+			} else {
+				http.Error(w, "Failed to update tag: "+err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(updatedtag)
 	}
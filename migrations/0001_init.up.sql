@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS post (
+    id SERIAL PRIMARY KEY,
+    title TEXT,
+    content TEXT,
+    status TEXT,
+    publishdate TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS tag (
+    id SERIAL PRIMARY KEY,
+    label TEXT UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS post_tag (
+    post_id INT REFERENCES post(id),
+    tag_id INT REFERENCES tag(id),
+    PRIMARY KEY (post_id, tag_id)
+);
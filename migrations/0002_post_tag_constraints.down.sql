@@ -0,0 +1,17 @@
+ALTER TABLE tag
+    DROP CONSTRAINT IF EXISTS tag_label_check,
+    ALTER COLUMN label DROP NOT NULL,
+    ALTER COLUMN label TYPE TEXT;
+
+DROP INDEX IF EXISTS post_publishdate_idx;
+DROP INDEX IF EXISTS post_status_idx;
+
+ALTER TABLE post
+    ALTER COLUMN status DROP NOT NULL,
+    ALTER COLUMN status DROP DEFAULT,
+    ALTER COLUMN status TYPE TEXT,
+    ALTER COLUMN content DROP NOT NULL,
+    ALTER COLUMN content DROP DEFAULT,
+    DROP CONSTRAINT IF EXISTS post_title_check,
+    ALTER COLUMN title DROP NOT NULL,
+    ALTER COLUMN title TYPE TEXT;
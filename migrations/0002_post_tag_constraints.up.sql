@@ -0,0 +1,38 @@
+UPDATE post SET content = '' WHERE content IS NULL;
+UPDATE post SET status = 'Draft' WHERE status IS NULL OR status = '';
+UPDATE post SET title = 'Untitled post ' || id WHERE title IS NULL OR title = '';
+UPDATE tag SET label = 'Untitled tag ' || id WHERE label IS NULL OR label = '';
+
+-- the type changes fail on longer values without saying which rows, list them instead
+DO $$
+DECLARE
+    long_titles TEXT;
+    long_labels TEXT;
+    long_statuses TEXT;
+BEGIN
+    SELECT string_agg(id::text, ', ' ORDER BY id) INTO long_titles FROM post WHERE length(title) > 200;
+    SELECT string_agg(id::text, ', ' ORDER BY id) INTO long_labels FROM tag WHERE length(label) > 100;
+    SELECT string_agg(id::text, ', ' ORDER BY id) INTO long_statuses FROM post WHERE length(status) > 20;
+    IF long_titles IS NOT NULL OR long_labels IS NOT NULL OR long_statuses IS NOT NULL THEN
+        RAISE EXCEPTION 'values too long, shorten them before migrating: post titles over 200 characters (ids %), tag labels over 100 characters (ids %), post statuses over 20 characters (ids %)',
+            coalesce(long_titles, 'none'), coalesce(long_labels, 'none'), coalesce(long_statuses, 'none');
+    END IF;
+END $$;
+
+ALTER TABLE post
+    ALTER COLUMN title TYPE varchar(200),
+    ALTER COLUMN title SET NOT NULL,
+    ADD CONSTRAINT post_title_check CHECK (length(title) > 0),
+    ALTER COLUMN content SET DEFAULT '',
+    ALTER COLUMN content SET NOT NULL,
+    ALTER COLUMN status TYPE varchar(20),
+    ALTER COLUMN status SET DEFAULT 'Draft',
+    ALTER COLUMN status SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS post_status_idx ON post (status);
+CREATE INDEX IF NOT EXISTS post_publishdate_idx ON post (publishdate);
+
+ALTER TABLE tag
+    ALTER COLUMN label TYPE varchar(100),
+    ALTER COLUMN label SET NOT NULL,
+    ADD CONSTRAINT tag_label_check CHECK (length(label) > 0);
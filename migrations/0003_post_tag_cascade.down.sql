@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS post_tag_tag_id_idx;
+
+ALTER TABLE post_tag
+    DROP COLUMN IF EXISTS created_at,
+    DROP COLUMN IF EXISTS position,
+    DROP CONSTRAINT IF EXISTS post_tag_tag_id_fkey,
+    ADD CONSTRAINT post_tag_tag_id_fkey FOREIGN KEY (tag_id) REFERENCES tag(id),
+    DROP CONSTRAINT IF EXISTS post_tag_post_id_fkey,
+    ADD CONSTRAINT post_tag_post_id_fkey FOREIGN KEY (post_id) REFERENCES post(id);
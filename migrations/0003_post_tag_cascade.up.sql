@@ -0,0 +1,9 @@
+ALTER TABLE post_tag
+    DROP CONSTRAINT IF EXISTS post_tag_post_id_fkey,
+    ADD CONSTRAINT post_tag_post_id_fkey FOREIGN KEY (post_id) REFERENCES post(id) ON DELETE CASCADE,
+    DROP CONSTRAINT IF EXISTS post_tag_tag_id_fkey,
+    ADD CONSTRAINT post_tag_tag_id_fkey FOREIGN KEY (tag_id) REFERENCES tag(id) ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS position INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS post_tag_tag_id_idx ON post_tag (tag_id);
@@ -0,0 +1,2 @@
+ALTER TABLE post
+    ALTER COLUMN publishdate TYPE TIMESTAMPTZ USING publishdate AT TIME ZONE 'UTC';
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS post_search_vector_idx;
+
+ALTER TABLE post
+    DROP COLUMN IF EXISTS search_vector;
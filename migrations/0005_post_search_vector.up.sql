@@ -0,0 +1,7 @@
+ALTER TABLE post
+    ADD COLUMN IF NOT EXISTS search_vector TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('english'::regconfig, coalesce(title::text, '')), 'A') ||
+        setweight(to_tsvector('english'::regconfig, coalesce(content::text, '')), 'B')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS post_search_vector_idx ON post USING GIN (search_vector);
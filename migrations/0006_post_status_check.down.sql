@@ -0,0 +1,3 @@
+-- statuses respelled by the up migration keep their new spelling
+ALTER TABLE post
+    DROP CONSTRAINT IF EXISTS post_status_check;
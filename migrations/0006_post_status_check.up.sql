@@ -0,0 +1,26 @@
+-- other spellings of the statuses, such as 'published' or 'in_review'
+UPDATE post SET status = CASE regexp_replace(lower(status), '[^a-z]', '', 'g')
+        WHEN 'draft' THEN 'Draft'
+        WHEN 'inreview' THEN 'InReview'
+        WHEN 'published' THEN 'Published'
+        WHEN 'archived' THEN 'Archived'
+    END
+WHERE status NOT IN ('Draft', 'InReview', 'Published', 'Archived')
+    AND regexp_replace(lower(status), '[^a-z]', '', 'g') IN ('draft', 'inreview', 'published', 'archived');
+
+-- any other status needs a decision, the migration lists the posts instead of guessing
+DO $$
+DECLARE
+    invalid TEXT;
+BEGIN
+    SELECT string_agg(format('%s (%L)', id, status), ', ' ORDER BY id) INTO invalid
+    FROM post
+    WHERE status NOT IN ('Draft', 'InReview', 'Published', 'Archived');
+    IF invalid IS NOT NULL THEN
+        RAISE EXCEPTION 'posts with an unknown status, set one of Draft, InReview, Published or Archived: %', invalid;
+    END IF;
+END $$;
+
+ALTER TABLE post
+    DROP CONSTRAINT IF EXISTS post_status_check,
+    ADD CONSTRAINT post_status_check CHECK (status IN ('Draft', 'InReview', 'Published', 'Archived'));
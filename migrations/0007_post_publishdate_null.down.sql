@@ -0,0 +1 @@
+-- NULL is the only form of an unset publish date, there is nothing to undo
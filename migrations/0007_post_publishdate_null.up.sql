@@ -0,0 +1 @@
+UPDATE post SET publishdate = NULL WHERE publishdate = '0001-01-01 00:00:00+00';
@@ -0,0 +1,12 @@
+// Package migrations holds the versioned SQL migrations of the api schema.
+//
+// Every migration is a pair of files named <version>_<name>.up.sql and
+// <version>_<name>.down.sql, version being a zero padded number.
+package migrations
+
+import "embed"
+
+// FS embeds every migration file of this directory
+//
+//go:embed *.sql
+var FS embed.FS
@@ -2,11 +2,24 @@ package model
 
 import "time"
 
+// statuses of the post lifecycle
+const (
+	PostStatusDraft     = "Draft"
+	PostStatusInReview  = "InReview"
+	PostStatusPublished = "Published"
+	PostStatusArchived  = "Archived"
+)
+
 type Post struct {
-	ID          int       `json:"id"`
-	Title       string    `json:"title"`
-	Content     string    `json:"content"`
-	Tags        []Tag     `json:"tags" key: many"`
-	Status      string    `json:"status"`
-	PublishDate time.Time `json:"publish_dte"`
+	ID          int        `json:"id" db:"id,pk,sort"`
+	Title       string     `json:"title" db:"title,type=varchar(200),notnull,sort,search=A,check=length(title) > 0"`
+	Content     string     `json:"content" db:"content,notnull,default='',search=B"`
+	Tags        []Tag      `json:"tags" rel:"many2many,join=post_tag,on_delete=cascade" payload:"position,type=integer,notnull,default=0;created_at,type=timestamptz,notnull,default=now()"`
+	Status      string     `json:"status" db:"status,type=varchar(20),notnull,default='Draft',index,sort,check=status IN ('Draft', 'InReview', 'Published', 'Archived')"`
+	PublishDate *time.Time `json:"publish_dte" db:"publishdate,index,sort=publish_date"`
+}
+
+// SearchConfig returns the text search configuration of the post search column
+func (Post) SearchConfig() string {
+	return "english"
 }
@@ -1,6 +1,6 @@
 package model
 
 type Tag struct {
-	ID    int    `json:"id"`
-	Label string `json:"label" key:"uniq"`
+	ID    int    `json:"id" db:"id,pk,sort"`
+	Label string `json:"label" db:"label,type=varchar(100),notnull,unique,sort,check=length(label) > 0"`
 }
@@ -0,0 +1,42 @@
+package sqlb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DDL statements cannot bind values. Names are quoted, types, defaults and
+// check expressions come from model tags and are written as is.
+
+// CreateDatabase returns a CREATE DATABASE statement
+func CreateDatabase(name string) string {
+	return "CREATE DATABASE " + Ident(name)
+}
+
+// CreateTable returns a CREATE TABLE IF NOT EXISTS statement of already
+// rendered column and constraint definitions
+func CreateTable(table string, definitions ...string) string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n\t%s\n);", Ident(table), strings.Join(definitions, ",\n\t"))
+}
+
+// ColumnDef renders a column definition, its quoted name followed by the
+// type and constraints
+func ColumnDef(name, sqlType string, constraints ...string) string {
+	return strings.Join(append([]string{Ident(name), sqlType}, constraints...), " ")
+}
+
+// AlterTable returns an ALTER TABLE statement of one or more actions
+func AlterTable(table string, actions ...string) string {
+	return fmt.Sprintf("ALTER TABLE %s %s;", Ident(table), strings.Join(actions, ", "))
+}
+
+// CreateIndex returns a CREATE INDEX IF NOT EXISTS statement
+func CreateIndex(name, table string, columns ...string) string {
+	return fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s);", Ident(name), Ident(table), Idents(columns...))
+}
+
+// CreateIndexUsing returns a CREATE INDEX IF NOT EXISTS statement of an
+// index using the given access method, such as gin
+func CreateIndexUsing(name, table, method string, columns ...string) string {
+	return fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s USING %s (%s);", Ident(name), Ident(table), method, Idents(columns...))
+}
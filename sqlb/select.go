@@ -0,0 +1,177 @@
+package sqlb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SelectBuilder builds a SELECT statement
+type SelectBuilder struct {
+	columns []Cond
+	from    string
+	joins   []joinClause
+	where   []Cond
+	groupBy []string
+	having  []Cond
+	orderBy []Cond
+	limit   int
+	offset  int
+	lock    bool
+}
+
+type joinClause struct {
+	kind  string
+	table string
+	on    Cond
+}
+
+// Select starts a SELECT of the given columns
+func Select(columns ...string) *SelectBuilder {
+	return (&SelectBuilder{}).Columns(columns...)
+}
+
+// Columns adds columns to the select list
+func (b *SelectBuilder) Columns(columns ...string) *SelectBuilder {
+	for _, column := range columns {
+		b.columns = append(b.columns, Cond{SQL: Ident(column)})
+	}
+	return b
+}
+
+// ColumnExpr adds an expression to the select list, e.g. count(*)
+func (b *SelectBuilder) ColumnExpr(expr string, args ...interface{}) *SelectBuilder {
+	b.columns = append(b.columns, Expr(expr, args...))
+	return b
+}
+
+// From sets the table, an optional alias follows it
+func (b *SelectBuilder) From(table string, alias ...string) *SelectBuilder {
+	b.from = tableRef(table, alias)
+	return b
+}
+
+// Join adds an INNER JOIN
+func (b *SelectBuilder) Join(table, alias string, on Cond) *SelectBuilder {
+	b.joins = append(b.joins, joinClause{kind: "INNER JOIN", table: tableRef(table, []string{alias}), on: on})
+	return b
+}
+
+// LeftJoin adds a LEFT JOIN
+func (b *SelectBuilder) LeftJoin(table, alias string, on Cond) *SelectBuilder {
+	b.joins = append(b.joins, joinClause{kind: "LEFT JOIN", table: tableRef(table, []string{alias}), on: on})
+	return b
+}
+
+// Where adds conditions, all of them have to match
+func (b *SelectBuilder) Where(conds ...Cond) *SelectBuilder {
+	b.where = append(b.where, conds...)
+	return b
+}
+
+// GroupBy adds GROUP BY columns
+func (b *SelectBuilder) GroupBy(columns ...string) *SelectBuilder {
+	b.groupBy = append(b.groupBy, columns...)
+	return b
+}
+
+// Having adds HAVING conditions, all of them have to match
+func (b *SelectBuilder) Having(conds ...Cond) *SelectBuilder {
+	b.having = append(b.having, conds...)
+	return b
+}
+
+// OrderBy adds a column to the ORDER BY clause
+func (b *SelectBuilder) OrderBy(column string, desc bool) *SelectBuilder {
+	order := Ident(column)
+	if desc {
+		order += " DESC"
+	}
+	b.orderBy = append(b.orderBy, Cond{SQL: order})
+	return b
+}
+
+// OrderByExpr adds an expression to the ORDER BY clause
+func (b *SelectBuilder) OrderByExpr(expr string, args ...interface{}) *SelectBuilder {
+	b.orderBy = append(b.orderBy, Expr(expr, args...))
+	return b
+}
+
+// Limit sets LIMIT, zero means no limit
+func (b *SelectBuilder) Limit(limit int) *SelectBuilder {
+	b.limit = limit
+	return b
+}
+
+// Offset sets OFFSET
+func (b *SelectBuilder) Offset(offset int) *SelectBuilder {
+	b.offset = offset
+	return b
+}
+
+// ForUpdate locks the selected rows until the end of the transaction
+func (b *SelectBuilder) ForUpdate() *SelectBuilder {
+	b.lock = true
+	return b
+}
+
+// Build returns the statement and its arguments
+func (b *SelectBuilder) Build() (string, []interface{}) {
+	return b.build(&args{})
+}
+
+// Cond returns the statement as a fragment with ? placeholders, to be used
+// as a subquery
+func (b *SelectBuilder) Cond() Cond {
+	query, values := b.build(&args{nested: true})
+	return Cond{SQL: query, Args: values}
+}
+
+func (b *SelectBuilder) build(a *args) (string, []interface{}) {
+	columns := make([]string, len(b.columns))
+	for i, column := range b.columns {
+		columns[i] = a.render(column)
+	}
+	query := "SELECT " + strings.Join(columns, ", ")
+
+	if b.from != "" {
+		query += " FROM " + b.from
+	}
+	for _, join := range b.joins {
+		query += fmt.Sprintf(" %s %s ON %s", join.kind, join.table, a.render(join.on))
+	}
+	if where := And(b.where...); where.SQL != "" {
+		query += " WHERE " + a.render(where)
+	}
+	if len(b.groupBy) > 0 {
+		query += " GROUP BY " + Idents(b.groupBy...)
+	}
+	if having := And(b.having...); having.SQL != "" {
+		query += " HAVING " + a.render(having)
+	}
+	if len(b.orderBy) > 0 {
+		orders := make([]string, len(b.orderBy))
+		for i, order := range b.orderBy {
+			orders[i] = a.render(order)
+		}
+		query += " ORDER BY " + strings.Join(orders, ", ")
+	}
+	if b.limit > 0 {
+		query += " LIMIT " + a.bind(b.limit)
+	}
+	if b.offset > 0 {
+		query += " OFFSET " + a.bind(b.offset)
+	}
+	if b.lock {
+		query += " FOR UPDATE"
+	}
+
+	return query, a.values
+}
+
+// tableRef quotes a table and its optional alias
+func tableRef(table string, alias []string) string {
+	if len(alias) > 0 && alias[0] != "" {
+		return Ident(table) + " " + Ident(alias[0])
+	}
+	return Ident(table)
+}
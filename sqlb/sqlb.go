@@ -0,0 +1,172 @@
+// Package sqlb builds SQL statements with quoted identifiers and bound
+// values, so names and user input never end up spliced into the SQL.
+//
+// Conditions and expressions are written with ? placeholders, which are
+// numbered $1, $2, ... in the order they appear in the built statement. A
+// literal question mark is written ??.
+package sqlb
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Ident quotes an identifier. A dotted name is a qualified name whose parts
+// are quoted one by one, post.id gives "post"."id", and * stays as is.
+func Ident(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		if part != "*" {
+			parts[i] = pq.QuoteIdentifier(part)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// Idents quotes identifiers and joins them with commas
+func Idents(names ...string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = Ident(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// Cond is a SQL fragment with ? placeholders and the values they bind
+type Cond struct {
+	SQL  string
+	Args []interface{}
+}
+
+// Expr returns a raw SQL fragment binding args to its ? placeholders, an
+// argument that is a Cond is written in place
+func Expr(sql string, args ...interface{}) Cond {
+	return Cond{SQL: sql, Args: args}
+}
+
+// Eq matches a column equal to value
+func Eq(column string, value interface{}) Cond {
+	return Cmp(column, "=", value)
+}
+
+// Cmp compares a column with a value using op, one of = <> < <= > >=
+func Cmp(column, op string, value interface{}) Cond {
+	switch op {
+	case "=", "<>", "<", "<=", ">", ">=":
+	default:
+		panic("sqlb: unsupported operator " + op)
+	}
+	return Cond{SQL: Ident(column) + " " + op + " ?", Args: []interface{}{value}}
+}
+
+// In matches a column equal to any element of the values slice
+func In(column string, values interface{}) Cond {
+	return Cond{SQL: Ident(column) + " = ANY(?)", Args: []interface{}{pq.Array(values)}}
+}
+
+// InQuery matches a column equal to any row of a subquery
+func InQuery(column string, sub *SelectBuilder) Cond {
+	cond := sub.Cond()
+	return Cond{SQL: Ident(column) + " IN (" + cond.SQL + ")", Args: cond.Args}
+}
+
+// ILike matches a column containing substr, case insensitively. LIKE
+// wildcards in substr are matched literally.
+func ILike(column, substr string) Cond {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(substr)
+	return Cond{SQL: Ident(column) + " ILIKE ?", Args: []interface{}{"%" + escaped + "%"}}
+}
+
+// And joins conditions with AND, empty conditions are ignored
+func And(conds ...Cond) Cond {
+	return join(" AND ", conds)
+}
+
+// Or joins conditions with OR, empty conditions are ignored
+func Or(conds ...Cond) Cond {
+	return join(" OR ", conds)
+}
+
+func join(sep string, conds []Cond) Cond {
+	var nonEmpty []Cond
+	for _, cond := range conds {
+		if cond.SQL != "" {
+			nonEmpty = append(nonEmpty, cond)
+		}
+	}
+	if len(nonEmpty) == 1 {
+		return nonEmpty[0]
+	}
+
+	var parts []string
+	var args []interface{}
+	for _, cond := range nonEmpty {
+		parts = append(parts, "("+cond.SQL+")")
+		args = append(args, cond.Args...)
+	}
+	return Cond{SQL: strings.Join(parts, sep), Args: args}
+}
+
+// args numbers the bound values of a statement. The placeholders of a
+// nested statement are left as ? for the enclosing one to number.
+type args struct {
+	values []interface{}
+	nested bool
+}
+
+// bind appends value and returns its placeholder
+func (a *args) bind(value interface{}) string {
+	a.values = append(a.values, value)
+	if a.nested {
+		return "?"
+	}
+	return fmt.Sprintf("$%d", len(a.values))
+}
+
+// render replaces the ? placeholders of a condition, outside quoted strings
+// and identifiers, with numbered ones. Arguments that are conditions are
+// inlined.
+func (a *args) render(cond Cond) string {
+	var b strings.Builder
+	var quote rune
+	next := 0
+	runes := []rune(cond.SQL)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '?' && i+1 < len(runes) && runes[i+1] == '?':
+			i++
+			if a.nested {
+				b.WriteRune(r)
+			}
+		case r == '?':
+			if next >= len(cond.Args) {
+				panic("sqlb: missing argument for placeholder in " + cond.SQL)
+			}
+			b.WriteString(a.value(cond.Args[next]))
+			next++
+			continue
+		}
+		b.WriteRune(r)
+	}
+	if next != len(cond.Args) {
+		panic("sqlb: too many arguments for " + cond.SQL)
+	}
+	return b.String()
+}
+
+// value renders a value: a Cond is inlined, anything else is bound
+func (a *args) value(value interface{}) string {
+	if cond, ok := value.(Cond); ok {
+		return a.render(cond)
+	}
+	return a.bind(value)
+}
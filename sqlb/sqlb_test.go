@@ -0,0 +1,157 @@
+package sqlb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name   string
+		cond   Cond
+		nested bool
+		want   string
+		args   []interface{}
+	}{
+		{
+			name: "placeholders are numbered in order",
+			cond: Expr("a = ? AND b = ?", 1, 2),
+			want: "a = $1 AND b = $2",
+			args: []interface{}{1, 2},
+		},
+		{
+			name: "double question mark is a literal one",
+			cond: Expr("data ?? 'key' AND id = ?", 7),
+			want: "data ? 'key' AND id = $1",
+			args: []interface{}{7},
+		},
+		{
+			name: "question marks in strings and identifiers are kept",
+			cond: Expr(`"a?" = '?' AND b = ?`, 1),
+			want: `"a?" = '?' AND b = $1`,
+			args: []interface{}{1},
+		},
+		{
+			name: "escaped quote inside a string",
+			cond: Expr("a = 'it''s ?' AND b = ?", 1),
+			want: "a = 'it''s ?' AND b = $1",
+			args: []interface{}{1},
+		},
+		{
+			name: "condition arguments are inlined and numbered",
+			cond: Expr("a = ? AND (?) AND c = ?", 1, Expr("b = ?", 2), 3),
+			want: "a = $1 AND (b = $2) AND c = $3",
+			args: []interface{}{1, 2, 3},
+		},
+		{
+			name:   "nested statements keep ? and ?? for the enclosing one",
+			cond:   Expr("a = ? AND data ?? 'key'", 1),
+			nested: true,
+			want:   "a = ? AND data ?? 'key'",
+			args:   []interface{}{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &args{nested: tt.nested}
+			got := a.render(tt.cond)
+			if got != tt.want {
+				t.Errorf("render() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(a.values, tt.args) {
+				t.Errorf("render() args = %v, want %v", a.values, tt.args)
+			}
+		})
+	}
+}
+
+func TestRenderArgumentCount(t *testing.T) {
+	tests := []struct {
+		name string
+		cond Cond
+	}{
+		{"missing argument", Expr("a = ? AND b = ?", 1)},
+		{"too many arguments", Expr("a = ?", 1, 2)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("render(%q) did not panic", tt.cond.SQL)
+				}
+			}()
+			(&args{}).render(tt.cond)
+		})
+	}
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func() (string, []interface{})
+		want  string
+		args  []interface{}
+	}{
+		{
+			name: "subquery placeholders follow the outer ones",
+			build: Select("id").From("post").
+				Where(Eq("status", "Draft"), InQuery("id", Select("post_id").From("post_tag").Where(Eq("tag_id", 3)))).
+				Limit(10).
+				Build,
+			want: `SELECT "id" FROM "post" WHERE ("status" = $1) AND ("id" IN (SELECT "post_id" FROM "post_tag" WHERE "tag_id" = $2)) LIMIT $3`,
+			args: []interface{}{"Draft", 3, 10},
+		},
+		{
+			name: "column expressions are numbered before the where clause",
+			build: Select().ColumnExpr("ts_rank(v, ?)", Expr("to_tsquery(?)", "go")).From("post").
+				Where(Expr("v @@ ?", Expr("to_tsquery(?)", "go"))).
+				Build,
+			want: `SELECT ts_rank(v, to_tsquery($1)) FROM "post" WHERE v @@ to_tsquery($2)`,
+			args: []interface{}{"go", "go"},
+		},
+		{
+			name:  "update values come before the where clause",
+			build: Update("tag").Set("label", "Go").Where(Eq("id", 1)).Build,
+			want:  `UPDATE "tag" SET "label" = $1 WHERE "id" = $2`,
+			args:  []interface{}{"Go", 1},
+		},
+		{
+			name:  "insert values may be expressions",
+			build: Insert("post_tag").Columns("post_id", "tag_id").Values(1, Expr("(SELECT id FROM tag WHERE label = ?)", "Go")).Build,
+			want:  `INSERT INTO "post_tag" ("post_id", "tag_id") VALUES ($1, (SELECT id FROM tag WHERE label = $2))`,
+			args:  []interface{}{1, "Go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, args := tt.build()
+			if got != tt.want {
+				t.Errorf("Build() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("Build() args = %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestIdent(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"post", `"post"`},
+		{"post.id", `"post"."id"`},
+		{"post.*", `"post".*`},
+		{`we"ird`, `"we""ird"`},
+	}
+
+	for _, tt := range tests {
+		if got := Ident(tt.name); got != tt.want {
+			t.Errorf("Ident(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package sqlb
+
+import "strings"
+
+// InsertBuilder builds an INSERT statement
+type InsertBuilder struct {
+	table     string
+	columns   []string
+	rows      [][]interface{}
+	conflict  string
+	returning []string
+}
+
+// Insert starts an INSERT into table
+func Insert(table string) *InsertBuilder {
+	return &InsertBuilder{table: table}
+}
+
+// Columns sets the inserted columns
+func (b *InsertBuilder) Columns(columns ...string) *InsertBuilder {
+	b.columns = append(b.columns, columns...)
+	return b
+}
+
+// Values adds a row, a Cond value is inlined as an expression
+func (b *InsertBuilder) Values(values ...interface{}) *InsertBuilder {
+	b.rows = append(b.rows, values)
+	return b
+}
+
+// OnConflictDoNothing skips rows conflicting with an existing one
+func (b *InsertBuilder) OnConflictDoNothing() *InsertBuilder {
+	b.conflict = " ON CONFLICT DO NOTHING"
+	return b
+}
+
+// OnConflictDoUpdate updates the given columns of the existing row when a
+// row conflicts with it on the target columns, turning the insert into an
+// upsert
+func (b *InsertBuilder) OnConflictDoUpdate(target []string, columns ...string) *InsertBuilder {
+	assignments := make([]string, len(columns))
+	for i, column := range columns {
+		assignments[i] = Ident(column) + " = EXCLUDED." + Ident(column)
+	}
+	b.conflict = " ON CONFLICT (" + Idents(target...) + ") DO UPDATE SET " + strings.Join(assignments, ", ")
+	return b
+}
+
+// Returning sets the RETURNING columns
+func (b *InsertBuilder) Returning(columns ...string) *InsertBuilder {
+	b.returning = append(b.returning, columns...)
+	return b
+}
+
+// Build returns the statement and its arguments. Without columns the row
+// is inserted with DEFAULT VALUES.
+func (b *InsertBuilder) Build() (string, []interface{}) {
+	a := &args{}
+
+	query := "INSERT INTO " + Ident(b.table)
+	if len(b.columns) == 0 {
+		query += " DEFAULT VALUES"
+	} else {
+		rows := make([]string, len(b.rows))
+		for i, row := range b.rows {
+			values := make([]string, len(row))
+			for j, value := range row {
+				values[j] = a.value(value)
+			}
+			rows[i] = "(" + strings.Join(values, ", ") + ")"
+		}
+		query += " (" + Idents(b.columns...) + ") VALUES " + strings.Join(rows, ", ")
+	}
+
+	return query + b.conflict + returning(b.returning), a.values
+}
+
+// UpdateBuilder builds an UPDATE statement
+type UpdateBuilder struct {
+	table     string
+	columns   []string
+	values    []interface{}
+	where     []Cond
+	returning []string
+}
+
+// Update starts an UPDATE of table
+func Update(table string) *UpdateBuilder {
+	return &UpdateBuilder{table: table}
+}
+
+// Set assigns a column, a Cond value is inlined as an expression
+func (b *UpdateBuilder) Set(column string, value interface{}) *UpdateBuilder {
+	b.columns = append(b.columns, column)
+	b.values = append(b.values, value)
+	return b
+}
+
+// Where adds conditions, all of them have to match
+func (b *UpdateBuilder) Where(conds ...Cond) *UpdateBuilder {
+	b.where = append(b.where, conds...)
+	return b
+}
+
+// Returning sets the RETURNING columns
+func (b *UpdateBuilder) Returning(columns ...string) *UpdateBuilder {
+	b.returning = append(b.returning, columns...)
+	return b
+}
+
+// Build returns the statement and its arguments
+func (b *UpdateBuilder) Build() (string, []interface{}) {
+	a := &args{}
+
+	assignments := make([]string, len(b.columns))
+	for i, column := range b.columns {
+		assignments[i] = Ident(column) + " = " + a.value(b.values[i])
+	}
+
+	query := "UPDATE " + Ident(b.table) + " SET " + strings.Join(assignments, ", ")
+	if where := And(b.where...); where.SQL != "" {
+		query += " WHERE " + a.render(where)
+	}
+	return query + returning(b.returning), a.values
+}
+
+// DeleteBuilder builds a DELETE statement
+type DeleteBuilder struct {
+	table string
+	where []Cond
+}
+
+// Delete starts a DELETE from table
+func Delete(table string) *DeleteBuilder {
+	return &DeleteBuilder{table: table}
+}
+
+// Where adds conditions, all of them have to match
+func (b *DeleteBuilder) Where(conds ...Cond) *DeleteBuilder {
+	b.where = append(b.where, conds...)
+	return b
+}
+
+// Build returns the statement and its arguments
+func (b *DeleteBuilder) Build() (string, []interface{}) {
+	a := &args{}
+
+	query := "DELETE FROM " + Ident(b.table)
+	if where := And(b.where...); where.SQL != "" {
+		query += " WHERE " + a.render(where)
+	}
+	return query, a.values
+}
+
+// returning renders a RETURNING clause
+func returning(columns []string) string {
+	if len(columns) == 0 {
+		return ""
+	}
+	return " RETURNING " + Idents(columns...)
+}